@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"real-time-forum/db"
+	"strconv"
+	"time"
+)
+
+const commandUsage = "usage: migrate up | migrate down [steps] | migrate status | seed"
+
+// runCommand runs a maintenance command given on the command line instead of starting the server
+func runCommand(database *sql.DB, args []string) error {
+	if len(args) == 1 && args[0] == "seed" {
+		applied, err := db.MigrateUp(database)
+		if len(applied) > 0 {
+			printMigrations("Applied", applied)
+		}
+		if err != nil {
+			return err
+		}
+		if err := db.Seed(database); err != nil {
+			return err
+		}
+		fmt.Println("Seeded the database with development fixtures")
+		return nil
+	}
+	if len(args) < 2 || args[0] != "migrate" {
+		return fmt.Errorf("unknown command, %s", commandUsage)
+	}
+
+	switch {
+	case args[1] == "up" && len(args) == 2:
+		applied, err := db.MigrateUp(database)
+		printMigrations("Applied", applied)
+		return err
+	case args[1] == "down" && len(args) <= 3:
+		steps := 1
+		if len(args) == 3 {
+			var err error
+			if steps, err = strconv.Atoi(args[2]); err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, %s", commandUsage)
+			}
+		}
+		reverted, err := db.MigrateDown(database, steps)
+		printMigrations("Reverted", reverted)
+		return err
+	case args[1] == "status" && len(args) == 2:
+		migrations, err := db.MigrationStatus(database)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if migration.AppliedAt != nil {
+				state = "applied " + migration.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command, %s", commandUsage)
+}
+
+func printMigrations(action string, migrations []db.Migration) {
+	if len(migrations) == 0 {
+		fmt.Println(action, "no migrations")
+	}
+	for _, migration := range migrations {
+		fmt.Printf("%s %04d_%s\n", action, migration.Version, migration.Name)
+	}
+}
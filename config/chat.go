@@ -0,0 +1,226 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	forumModels "real-time-forum/modules/forumManagement/models"
+	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/validation"
+	"time"
+)
+
+// Errors of the chat operations, shared by the HTTP endpoints and the WebSocket protocol
+var (
+	ErrNotChatMember = errors.New("not a member of this chat")
+	ErrUnknownUser   = errors.New("unknown user")
+	ErrRateLimited   = errors.New("too many messages") // beyond the messages rate limit
+)
+
+// SentMessage describes a stored chat message
+type SentMessage struct {
+	MessageID int
+	ChatUUID  string
+	CreatedAt time.Time
+	Delivered bool // a recipient was connected when the message was sent
+}
+
+// ChatAudience resolves who chat events are addressed to. A direct chat is addressed
+// to the other user, a group chat to its own UUID, and the members list routes them
+func ChatAudience(chat forumModels.Chat, userID int) (string, []string, error) {
+	memberUUIDs, err := forumModels.Chats.ReadChatMemberUUIDs(chat.ID, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if chat.Type == "group" {
+		return chat.UUID, memberUUIDs, nil
+	}
+	if len(memberUUIDs) == 0 {
+		return "", nil, sql.ErrNoRows
+	}
+	return memberUUIDs[0], memberUUIDs, nil
+}
+
+// readChatForMember is forumModels.Chats.ReadChatForMember with non-members reported as ErrNotChatMember
+func readChatForMember(chatUUID string, userID int) (forumModels.Chat, error) {
+	chat, err := forumModels.Chats.ReadChatForMember(chatUUID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return chat, ErrNotChatMember
+	}
+	return chat, err
+}
+
+// SendChatMessage stores a message and pushes it to the chat members. Without a chat UUID
+// the message goes to the direct chat with receiverUUID, which is created if needed
+func SendChatMessage(sender userModels.User, chatUUID string, receiverUUID string, content string, format string) (SentMessage, error) {
+	if err := validation.Message(content); err != nil {
+		return SentMessage{}, err
+	}
+	if ok, _ := messageLimiter.Allow(sender.UUID); !ok {
+		return SentMessage{}, ErrRateLimited
+	}
+
+	isGroup := false
+	var memberUUIDs []string
+
+	if chatUUID != "" {
+		chat, err := readChatForMember(chatUUID, sender.ID)
+		if err != nil {
+			return SentMessage{}, err
+		}
+
+		isGroup = chat.Type == "group"
+		receiverUUID, memberUUIDs, err = ChatAudience(chat, sender.ID)
+		if err != nil {
+			return SentMessage{}, err
+		}
+	} else {
+		receiverID, err := userModels.Users.FindUserByUUID(receiverUUID)
+		if err != nil {
+			return SentMessage{}, err
+		}
+		if receiverID <= 0 || receiverID == sender.ID {
+			return SentMessage{}, ErrUnknownUser
+		}
+
+		// Double check for chat with both user IDs (If two users open chat before any message is sent)
+		chatUUID, err = forumModels.Chats.FindChatUUIDbyUserIDS(sender.ID, receiverID)
+		if err != nil {
+			return SentMessage{}, err
+		}
+		if chatUUID == "" {
+			chatUUID, err = forumModels.Chats.InsertChat(sender.ID, receiverID)
+			if err != nil {
+				return SentMessage{}, err
+			}
+		}
+	}
+
+	messageID, err := forumModels.Chats.InsertMessage(content, format, sender.ID, chatUUID)
+	if err != nil {
+		return SentMessage{}, err
+	}
+
+	sent := SentMessage{
+		MessageID: messageID,
+		ChatUUID:  chatUUID,
+		CreatedAt: time.Now(),
+	}
+
+	var msg Message
+	msg.MsgType = "sendMessage"
+	msg.Updated = false
+	msg.UserUUID = sender.UUID
+	msg.PrivateMessage.Message.CreatedAt = sent.CreatedAt
+	msg.PrivateMessage.Message.SenderUsername = sender.Username
+	msg.PrivateMessage.Message.Content = content
+	msg.PrivateMessage.Message.Format = format
+	msg.PrivateMessage.Message.RenderContent()
+	msg.PrivateMessage.Message.ChatUUID = chatUUID
+	msg.ReciverUserUUID = receiverUUID
+	msg.ReciverUserUUIDs = memberUUIDs
+	msg.IsGroup = isGroup
+	msg.PrivateMessage.Message.ID = messageID
+	msg.PrivateMessage.IsCreatedBy = true // change when sent to other user at Broadcast handler
+
+	// Offline receivers get the message as a backlog on their next connect,
+	// group members catch up from the unread counter instead
+	if isGroup {
+		sent.Delivered = true
+	} else if IsOnline(receiverUUID) {
+		sent.Delivered = true
+		if err := forumModels.Chats.MarkMessageDelivered(messageID); err != nil {
+			slog.Error("Error marking message delivered", "message_id", messageID, "err", err)
+		}
+	}
+
+	// A sent message ends the sender's typing state in the chat
+	stopTyping(typingKey{userUUID: sender.UUID, chatUUID: chatUUID})
+
+	Broadcast <- msg
+	return sent, nil
+}
+
+// LoadHistory reads one page of a chat as a showMessages message. The limit is
+// clamped to the configured page sizes, before and after are message ID cursors
+func LoadHistory(user userModels.User, chatUUID string, receiverUUID string, limit int, before int, after int) (Message, error) {
+	var msg Message
+	msg.MsgType = "showMessages"
+	msg.Updated = false
+	msg.UserUUID = user.UUID
+	msg.ReciverUserUUID = receiverUUID
+
+	paging := Current().Paging
+	if limit <= 0 {
+		limit = paging.MessagePageSize
+	}
+	if limit > paging.MaxMessagePageSize {
+		limit = paging.MaxMessagePageSize
+	}
+	msg.Before = before
+	msg.After = after
+
+	if chatUUID != "" {
+		chat, err := readChatForMember(chatUUID, user.ID)
+		if err != nil {
+			return Message{}, err
+		}
+		if chat.Type == "group" {
+			msg.IsGroup = true
+			msg.ReciverUserUUID = chat.UUID
+			msg.ReceiverUserName = chat.Name
+		}
+	}
+
+	var err error
+	msg.Messages, msg.HasMore, err = forumModels.Chats.ReadAllMessages(chatUUID, before, after, limit, user.ID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if !msg.IsGroup {
+		msg.ReceiverUserName, err = userModels.Users.FindUsername(msg.ReciverUserUUID)
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
+	return msg, nil
+}
+
+// MarkChatRead stores the read state and tells the other members with a read receipt
+func MarkChatRead(chatUUID string, reader userModels.User) error {
+	lastReadID, err := forumModels.Chats.MarkChatRead(chatUUID, reader.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotChatMember
+	}
+	if err != nil {
+		return err
+	}
+	if lastReadID == 0 {
+		return nil
+	}
+
+	chat, err := readChatForMember(chatUUID, reader.ID)
+	if err != nil {
+		return err
+	}
+	reciverUUID, memberUUIDs, err := ChatAudience(chat, reader.ID)
+	if err != nil {
+		return err
+	}
+
+	readAt := time.Now()
+	var msg Message
+	msg.MsgType = "readReceipt"
+	msg.UserUUID = reader.UUID
+	msg.ReciverUserUUID = reciverUUID
+	msg.ReciverUserUUIDs = memberUUIDs
+	msg.PrivateMessage.Message.ID = lastReadID
+	msg.PrivateMessage.Message.ChatUUID = chatUUID
+	msg.PrivateMessage.Message.ReadAt = &readAt
+
+	Broadcast <- msg
+	return nil
+}
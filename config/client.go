@@ -0,0 +1,169 @@
+package config
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second    // Time allowed to write a message to the peer
+	pongWait       = 60 * time.Second    // Time allowed to read the next pong message from the peer
+	pingPeriod     = (pongWait * 9) / 10 // Send pings to peer with this period, must be less than pongWait
+	maxMessageSize = 4096                // Maximum size of an inbound message
+	sendBufferSize = 256                 // Outbound messages buffered per connection
+)
+
+// Client is a single WebSocket connection with its own outbound queue
+type Client struct {
+	UserUUID string
+	conn     *websocket.Conn
+	log      *slog.Logger // carries the request ID of the connection and the user
+	send     chan any
+	done     chan struct{}
+	once     sync.Once
+	closing  []byte // close frame written by the write pump once done is closed
+}
+
+func NewClient(userUUID string, conn *websocket.Conn, logger *slog.Logger) *Client {
+	return &Client{
+		UserUUID: userUUID,
+		conn:     conn,
+		log:      logger,
+		send:     make(chan any, sendBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Queue puts a message on the outbound buffer without blocking,
+// returns false if the client is closed or its buffer is full
+func (c *Client) Queue(msg any) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the write pump, which in turn closes the connection
+func (c *Client) Close() {
+	c.CloseWithReason(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithReason is Close with the status code and reason sent to the peer, the first close wins
+func (c *Client) CloseWithReason(code int, reason string) {
+	c.once.Do(func() {
+		c.closing = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// writePump is the only goroutine allowed to write to the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.log.Warn("WebSocket write failed", "err", err)
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, c.closing)
+			return
+		}
+	}
+}
+
+// deliver queues a message for the client and evicts it if it can't keep up.
+// Mu must be held by the caller
+func deliver(client *Client, msg any) {
+	if !client.Queue(msg) {
+		client.log.Warn("Evicting slow WebSocket client")
+		client.Close()
+	}
+}
+
+// sendToUser fans a message out to every connection of the user.
+// Mu must be held by the caller
+func sendToUser(userUUID string, msg any) {
+	for client := range Clients[userUUID] {
+		deliver(client, msg)
+	}
+}
+
+// register adds a connection of the user
+func register(client *Client) {
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	if shuttingDown {
+		client.CloseWithReason(websocket.CloseServiceRestart, shutdownReason)
+	}
+
+	connections, ok := Clients[client.UserUUID]
+	if !ok {
+		connections = make(map[*Client]bool)
+		Clients[client.UserUUID] = connections
+	}
+	connections[client] = true
+}
+
+// unregister removes a connection and reports whether it was the user's last one
+func unregister(client *Client) bool {
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	connections, ok := Clients[client.UserUUID]
+	if !ok || !connections[client] {
+		return false
+	}
+	delete(connections, client)
+	if len(connections) > 0 {
+		return false
+	}
+	delete(Clients, client.UserUUID)
+	return true
+}
+
+// IsOnline reports whether the user has at least one open connection
+func IsOnline(userUUID string) bool {
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	_, ok := Clients[userUUID]
+	return ok
+}
+
+// DisconnectUser closes every connection of the user, e.g. on logout
+func DisconnectUser(userUUID string) {
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	for client := range Clients[userUUID] {
+		client.Close()
+	}
+}
@@ -10,33 +10,33 @@ import (
 )
 
 type Message struct {
-	Post                    forumModels.Post             `json:"post"`
-	Comment                 forumModels.Comment          `json:"comment"`
-	MsgType                 string                       `json:"msgType"`
-	Updated                 bool                         `json:"updated"`
-	UserUUID                string                       `json:"uuid"`
-	IsLikAction             bool                         `json:"isLikeAction"`
-	NumberOfReplis          int                          `json:"numberOfReplies"`
-	IsReplied               bool                         `json:"isReplied"`
-	ChattedUsers            []forumModels.ChatUser       `json:"chattedUsers"`
-	UnchattedUsers          []forumModels.ChatUser       `json:"unchattedUsers"`
-	PrivateMessage          forumModels.PrivateMessage   `json:"privateMessage"`
-	ReciverUserUUID         string                       `json:"reciverUserUUID"`
-	ReceiverUserName        string                       `json:"receiverUserName"`
-	Messages                []forumModels.PrivateMessage `json:"privateMessages"`
-	SendNotification        bool                         `json:"notification"`
-	GotAllMessagesRequested bool                         `json:"allMessagesGot"`
+	Post             forumModels.Post             `json:"post"`
+	Comment          forumModels.Comment          `json:"comment"`
+	MsgType          string                       `json:"msgType"`
+	Updated          bool                         `json:"updated"`
+	UserUUID         string                       `json:"uuid"`
+	IsLikAction      bool                         `json:"isLikeAction"`
+	NumberOfReplis   int                          `json:"numberOfReplies"`
+	IsReplied        bool                         `json:"isReplied"`
+	ChattedUsers     []forumModels.ChatUser       `json:"chattedUsers"`
+	UnchattedUsers   []forumModels.ChatUser       `json:"unchattedUsers"`
+	PrivateMessage   forumModels.PrivateMessage   `json:"privateMessage"`
+	ReciverUserUUID  string                       `json:"reciverUserUUID"`
+	ReciverUserUUIDs []string                     `json:"-"` // group chat members, used for routing only
+	ReceiverUserName string                       `json:"receiverUserName"`
+	Messages         []forumModels.PrivateMessage `json:"privateMessages"`
+	SendNotification bool                         `json:"notification"`
+	IsGroup          bool                         `json:"isGroup"`
+	HasMore          bool                         `json:"hasMore"`
+	Before           int                          `json:"before"`
+	After            int                          `json:"after"`
+	RequestID        string                       `json:"requestId,omitempty"` // correlation ID of a WebSocket request
 }
 
 var (
 	HomeTmpl  *template.Template
 	Upgrader  = websocket.Upgrader{}
-	Clients   = make(map[string]*websocket.Conn)
+	Clients   = make(map[string]map[*Client]bool) // user UUID -> open connections
 	Broadcast = make(chan Message)
 	Mu        sync.Mutex
 )
-
-const (
-	TitleMaxLen   int = 100
-	ContentMaxLen int = 3000
-)
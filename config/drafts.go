@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	forumModels "real-time-forum/modules/forumManagement/models"
+	"time"
+)
+
+const publishSweep = 15 * time.Second // How often scheduled drafts are checked for their publish time
+
+// PublishDraft publishes a draft and broadcasts it like a newly created post
+func PublishDraft(draft forumModels.Post) (forumModels.Post, error) {
+	if err := forumModels.Posts.PublishDraft(&draft); err != nil {
+		return forumModels.Post{}, err
+	}
+
+	post, err := forumModels.Posts.ReadPostByUUID(draft.UUID, draft.UserId)
+	if err != nil {
+		return forumModels.Post{}, err
+	}
+	post.User = draft.User
+
+	var msg Message
+	msg.MsgType = "post"
+	msg.Updated = false
+	msg.Post = post
+	msg.UserUUID = draft.User.UUID
+	Broadcast <- msg
+
+	return post, nil
+}
+
+// HandleScheduledPosts periodically publishes the drafts whose publish time has come, until ctx is done
+func HandleScheduledPosts(ctx context.Context) {
+	ticker := time.NewTicker(publishSweep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		drafts, err := forumModels.Posts.ReadDueDrafts()
+		if err != nil {
+			slog.Error("Error reading scheduled posts", "err", err)
+			continue
+		}
+		for _, draft := range drafts {
+			// A draft the author published or deleted meanwhile is skipped
+			if _, err := PublishDraft(draft); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				slog.Error("Error publishing scheduled post", "post", draft.UUID, "err", err)
+			}
+		}
+	}
+}
@@ -2,9 +2,12 @@ package config
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	forumModels "real-time-forum/modules/forumManagement/models"
 	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"time"
 )
 
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -15,6 +18,7 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		err := HomeTmpl.Execute(w, nil)
 		if err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering home page", "err", err)
 			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -23,15 +27,12 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Tell all connected Clients to update Clients list
-func TellAllToUpdateClients() {
-	var msg Message
-	msg.MsgType = "updateClients"
-	Broadcast <- msg
-}
-
 // Handle WebSocket connections
 func HandleConnections(w http.ResponseWriter, r *http.Request) {
+	// Counted while the request is still tracked by the HTTP server, so Shutdown can wait for it
+	connections.Add(1)
+	defer connections.Done()
+
 	sessionToken := r.URL.Query().Get("session")
 	if sessionToken == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -41,8 +42,9 @@ func HandleConnections(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	user, _, err := userModels.SelectSession(sessionToken)
+	user, _, err := userModels.Sessions.SelectSession(sessionToken)
 	if err != nil {
+		slog.WarnContext(r.Context(), "WebSocket session not found", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -50,9 +52,11 @@ func HandleConnections(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.SetRequestUser(r.Context(), user.UUID)
+
 	conn, err := Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("WebSocket error:", err)
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -60,116 +64,142 @@ func HandleConnections(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	defer conn.Close()
-	Mu.Lock()
-	Clients[user.UUID] = conn
-	Mu.Unlock()
-	TellAllToUpdateClients()
+	connected := time.Now()
+	client := NewClient(user.UUID, conn, slog.With("request_id", utils.RequestID(r.Context()), "user", user.UUID))
+	go client.writePump()
 
-	for {
-		var msg map[string]string
-		err := conn.ReadJSON(&msg)
+	register(client)
+	client.log.Info("WebSocket connected", "remote", r.RemoteAddr)
+	presenceConnected(user.UUID)
+	sendBacklog(client, user.ID)
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
 
+	for {
+		_, data, err := conn.ReadMessage()
 		if err != nil {
+			client.log.Info("WebSocket disconnected", "reason", err.Error(), "duration", time.Since(connected))
 			break
 		}
+		handleInbound(client, user, data)
+	}
 
-		// Broadcast typing event
-		if msg["type"] == "typing" {
-			if _, ok := Clients[msg["to"]]; ok {
-				Clients[msg["to"]].WriteJSON(map[string]string{
-					"msgType":  "typing",
-					"userFrom": msg["from"],
-				})
-			}
-		}
-		if msg["type"] == "stopped_typing" {
-			if _, ok := Clients[msg["to"]]; ok {
-				Clients[msg["to"]].WriteJSON(map[string]string{
-					"msgType":  "stopped_typing",
-					"userFrom": msg["from"],
-				})
-			}
-		}
+	client.Close()
+	presenceDisconnected(user.UUID)
+
+	// The user stays online while any other tab or device is connected
+	if unregister(client) {
+		stopAllTyping(user.UUID)
+		userModels.Users.UpdateOnlineTime(user.UUID)
 	}
+}
+
+// Push private messages received while offline to a freshly connected client
+func sendBacklog(client *Client, userID int) {
+	backlog, err := forumModels.Chats.ReadUndeliveredMessages(userID)
+	if err != nil {
+		client.log.Error("Error reading message backlog", "err", err)
+		return
+	}
+	if len(backlog) == 0 {
+		return
+	}
+
+	var msg Message
+	msg.MsgType = "messageBacklog"
+	msg.UserUUID = client.UserUUID
+	msg.Messages = backlog
+	msg.SendNotification = true
 
 	Mu.Lock()
-	delete(Clients, user.UUID)
-	userModels.UpdateOnlineTime(user.UUID)
+	queued := client.Queue(msg)
 	Mu.Unlock()
+	if !queued {
+		return
+	}
 
-	TellAllToUpdateClients()
+	// Unread counters are driven by read state, so the backlog only needs to arrive once
+	messageIDs := make([]int, len(backlog))
+	for i, m := range backlog {
+		messageIDs[i] = m.Message.ID
+	}
+	if err := forumModels.Chats.MarkMessagesDelivered(messageIDs); err != nil {
+		client.log.Error("Error marking message backlog delivered", "err", err)
+	}
 }
 
-// Broadcast new posts
-func HandleBroadcasts() {
-	for {
-		msg := <-Broadcast
-		Mu.Lock()
-		specificClient, exists := Clients[msg.UserUUID]
-		Mu.Unlock()
-
-		// Broadcast to self
-		if exists && msg.MsgType != "" {
-			err := specificClient.WriteJSON(msg)
-			if err != nil {
-				specificClient.Close()
-				Mu.Lock()
-				delete(Clients, msg.UserUUID)
-				userModels.UpdateOnlineTime(msg.UserUUID)
-				Mu.Unlock()
-
-				TellAllToUpdateClients()
-			}
+// recipients lists the users a chat event is addressed to, every other member for group chats
+func recipients(msg Message) []string {
+	if len(msg.ReciverUserUUIDs) > 0 {
+		return msg.ReciverUserUUIDs
+	}
+	return []string{msg.ReciverUserUUID}
+}
 
-			if msg.MsgType == "listOfChat" || msg.MsgType == "showMessages" {
-				continue
+// Broadcast new posts until stop is closed
+func HandleBroadcasts(stop <-chan struct{}) {
+	for {
+		select {
+		case msg := <-Broadcast:
+			broadcast(msg)
+		case <-stop:
+			// Senders already waiting on the channel still get their message through
+			for {
+				select {
+				case msg := <-Broadcast:
+					broadcast(msg)
+				default:
+					return
+				}
 			}
 		}
+	}
+}
 
-		// Broadcast to one recipient
-		if msg.MsgType == "sendMessage" {
-
-			msg.PrivateMessage.IsCreatedBy = false
-			msg.SendNotification = true
-			if receiverConn, ok := Clients[msg.ReciverUserUUID]; ok {
-				Mu.Lock()
-				err := receiverConn.WriteJSON(msg)
-				Mu.Unlock()
-				if err != nil {
-					receiverConn.Close()
-					delete(Clients, msg.ReciverUserUUID)
-					userModels.UpdateOnlineTime(msg.ReciverUserUUID)
-				}
-			} // already checked receiver exists
-			continue
-		}
+func broadcast(msg Message) {
+	Mu.Lock()
+	defer Mu.Unlock()
 
-		// Broadcast to all other Clients
-		Mu.Lock()
-		for uuid, client := range Clients {
+	// Broadcast to self
+	if msg.MsgType != "" {
+		sendToUser(msg.UserUUID, msg)
+	}
+	if msg.MsgType == "listOfChat" || msg.MsgType == "showMessages" {
+		return
+	}
 
-			if uuid == msg.UserUUID {
-				continue
-			}
+	// Broadcast to the other chat members
+	if msg.MsgType == "sendMessage" || msg.MsgType == "messageEdited" || msg.MsgType == "messageDeleted" {
+		msg.PrivateMessage.IsCreatedBy = false
+		msg.SendNotification = msg.MsgType == "sendMessage"
+		for _, uuid := range recipients(msg) {
+			sendToUser(uuid, msg)
+		}
+		return
+	}
+	if msg.MsgType == "readReceipt" || msg.MsgType == "chatUpdated" {
+		for _, uuid := range recipients(msg) {
+			sendToUser(uuid, msg)
+		}
+		return
+	}
 
-			msg.Comment.IsLikedByUser = false
-			msg.Comment.IsDislikedByUser = false
-			msg.Post.IsDislikedByUser = false
-			msg.Post.IsLikedByUser = false
-			msg.IsLikAction = false
-
-			Mu.Unlock()
-			err := client.WriteJSON(msg)
-			Mu.Lock()
-
-			if err != nil {
-				client.Close()
-				delete(Clients, uuid)
-				userModels.UpdateOnlineTime(uuid)
-				TellAllToUpdateClients()
-			}
+	// Broadcast to all other Clients
+	msg.Comment.IsLikedByUser = false
+	msg.Comment.IsDislikedByUser = false
+	msg.Post.IsDislikedByUser = false
+	msg.Post.IsLikedByUser = false
+	msg.IsLikAction = false
+
+	for uuid := range Clients {
+		if uuid == msg.UserUUID {
+			continue
 		}
-		Mu.Unlock()
+		sendToUser(uuid, msg)
 	}
 }
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
+	"time"
+)
+
+// InboundMessage is the envelope of every message a client sends over the WebSocket.
+// The sender is always the user the connection was authenticated as
+type InboundMessage struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"` // correlation ID, echoed in the ack or error
+	ChatUUID string `json:"chatUUID"`
+	To       string `json:"to"` // other user of a direct chat, when the client doesn't know the chat UUID
+	Content  string `json:"content"`
+	Markdown bool   `json:"markdown"` // sendMessage only, opt in to rendering the content as Markdown
+	Limit    int    `json:"limit"`
+	Before   int    `json:"before"`
+	After    int    `json:"after"`
+	Active   bool   `json:"active"` // heartbeat only, whether the user interacted since the last one
+}
+
+// Ack confirms a request, for sendMessage it carries the stored message ID and server time
+type Ack struct {
+	MsgType   string    `json:"msgType"`
+	ID        string    `json:"id"`
+	MessageID int       `json:"messageId,omitempty"`
+	ChatUUID  string    `json:"chatUUID,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ErrorReply rejects a request with a machine readable code
+type ErrorReply struct {
+	MsgType string            `json:"msgType"`
+	ID      string            `json:"id"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Errors  validation.Errors `json:"errors,omitempty"` // invalid_input only, the rejected fields
+}
+
+// handleInbound decodes one client message and dispatches it by type
+func handleInbound(client *Client, user userModels.User, data []byte) {
+	var msg InboundMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		client.log.Warn("Invalid WebSocket message", "err", err)
+		replyError(client, "", "invalid_request", "Invalid JSON")
+		return
+	}
+
+	switch msg.Type {
+	case "typing", "stopped_typing":
+		handleTyping(client, user, msg)
+	case "sendMessage":
+		handleSendMessage(client, user, msg)
+	case "loadHistory":
+		handleLoadHistory(client, user, msg)
+	case "markRead":
+		handleMarkRead(client, user, msg)
+	case "heartbeat":
+		presenceHeartbeat(user.UUID, msg.Active)
+	default:
+		client.log.Warn("Unknown WebSocket message type", "type", msg.Type)
+		replyError(client, msg.ID, "unknown_type", "Unknown message type")
+	}
+}
+
+func handleSendMessage(client *Client, user userModels.User, msg InboundMessage) {
+	sent, err := SendChatMessage(user, msg.ChatUUID, msg.To, msg.Content, utils.FormatFor(msg.Markdown))
+	if err != nil {
+		replyChatError(client, msg.ID, err)
+		return
+	}
+
+	reply(client, Ack{
+		MsgType:   "ack",
+		ID:        msg.ID,
+		MessageID: sent.MessageID,
+		ChatUUID:  sent.ChatUUID,
+		Timestamp: sent.CreatedAt,
+	})
+}
+
+// handleLoadHistory answers with a showMessages page for this connection only
+func handleLoadHistory(client *Client, user userModels.User, msg InboundMessage) {
+	history, err := LoadHistory(user, msg.ChatUUID, msg.To, msg.Limit, msg.Before, msg.After)
+	if err != nil {
+		replyChatError(client, msg.ID, err)
+		return
+	}
+	history.RequestID = msg.ID
+
+	reply(client, history)
+	reply(client, Ack{MsgType: "ack", ID: msg.ID, ChatUUID: msg.ChatUUID, Timestamp: time.Now()})
+
+	// Loading the chat means the user has seen its messages
+	if msg.ChatUUID != "" {
+		if err := MarkChatRead(msg.ChatUUID, user); err != nil {
+			client.log.Error("Error marking chat read", "chat", msg.ChatUUID, "err", err)
+		}
+	}
+}
+
+func handleMarkRead(client *Client, user userModels.User, msg InboundMessage) {
+	if msg.ChatUUID == "" {
+		replyError(client, msg.ID, "invalid_request", "Missing chat")
+		return
+	}
+	if err := MarkChatRead(msg.ChatUUID, user); err != nil {
+		replyChatError(client, msg.ID, err)
+		return
+	}
+
+	reply(client, Ack{MsgType: "ack", ID: msg.ID, ChatUUID: msg.ChatUUID, Timestamp: time.Now()})
+}
+
+func reply(client *Client, msg any) {
+	Mu.Lock()
+	defer Mu.Unlock()
+	deliver(client, msg)
+}
+
+func replyError(client *Client, id string, code string, message string) {
+	reply(client, ErrorReply{MsgType: "error", ID: id, Code: code, Message: message})
+}
+
+// replyChatError maps the chat errors to codes, anything unexpected is logged
+func replyChatError(client *Client, id string, err error) {
+	var invalid validation.Errors
+	switch {
+	case errors.Is(err, ErrNotChatMember):
+		replyError(client, id, "not_member", err.Error())
+	case errors.As(err, &invalid):
+		reply(client, ErrorReply{MsgType: "error", ID: id, Code: "invalid_input", Message: "Invalid input", Errors: invalid})
+	case errors.Is(err, ErrUnknownUser):
+		replyError(client, id, "unknown_user", err.Error())
+	case errors.Is(err, ErrRateLimited):
+		replyError(client, id, "rate_limited", err.Error())
+	default:
+		client.log.Error("WebSocket request failed", "id", id, "err", err)
+		replyError(client, id, "internal_error", "Internal server error")
+	}
+}
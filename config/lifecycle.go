@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	userModels "real-time-forum/modules/userManagement/models"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdownReason is sent with the close frame of every WebSocket when the server stops
+const shutdownReason = "server restarting"
+
+// Goroutines of the hub, started by Start and stopped by Shutdown
+var (
+	stopJobs     context.CancelFunc
+	jobs         sync.WaitGroup
+	stopHub      = make(chan struct{})
+	hubStopped   = make(chan struct{})
+	connections  sync.WaitGroup // running HandleConnections
+	shuttingDown bool           // guarded by Mu, connections registered after Shutdown are closed right away
+)
+
+// Start runs the broadcast hub and the periodic presence and scheduled post jobs
+func Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopJobs = cancel
+	for _, job := range []func(context.Context){HandlePresence, HandleScheduledPosts} {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(ctx)
+		}()
+	}
+	go func() {
+		HandleBroadcasts(stopHub)
+		close(hubStopped)
+	}()
+}
+
+// Shutdown stops the hub once the HTTP server no longer takes requests. The periodic jobs finish,
+// every WebSocket connection is closed, the last time online of its user is recorded
+// and messages still waiting for the hub are delivered. It stops waiting when ctx is done
+func Shutdown(ctx context.Context) error {
+	var errs []error
+
+	stopJobs()
+	if err := wait(ctx, jobs.Wait); err != nil {
+		errs = append(errs, fmt.Errorf("periodic jobs: %w", err))
+	}
+
+	Mu.Lock()
+	shuttingDown = true
+	var users []string
+	for userUUID, clients := range Clients {
+		users = append(users, userUUID)
+		for client := range clients {
+			client.CloseWithReason(websocket.CloseServiceRestart, shutdownReason)
+		}
+	}
+	Mu.Unlock()
+	slog.Info("Closing WebSocket connections", "users", len(users))
+	if err := wait(ctx, connections.Wait); err != nil {
+		errs = append(errs, fmt.Errorf("WebSocket connections: %w", err))
+	}
+
+	// Connections that ended in time recorded it already, this covers the ones that didn't
+	for _, userUUID := range users {
+		if err := userModels.Users.UpdateOnlineTime(userUUID); err != nil {
+			errs = append(errs, fmt.Errorf("last time online of %s: %w", userUUID, err))
+		}
+	}
+
+	close(stopHub)
+	if err := wait(ctx, func() { <-hubStopped }); err != nil {
+		errs = append(errs, fmt.Errorf("broadcasts: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// wait returns once done does, or with the error of ctx when it ends first
+func wait(ctx context.Context, done func()) error {
+	finished := make(chan struct{})
+	go func() {
+		done()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	idleAfter        = 2 * time.Minute  // Connected users without an active heartbeat for this long are idle
+	presenceSweep    = 30 * time.Second // How often connected users are checked for going idle
+	presenceDebounce = 2 * time.Second  // State changes settle this long before they are published
+)
+
+// Presence states
+const (
+	PresenceOnline  = "online"
+	PresenceIdle    = "idle"
+	PresenceOffline = "offline"
+)
+
+// PresenceEvent tells clients about the new state of a single user
+type PresenceEvent struct {
+	MsgType        string    `json:"msgType"`
+	UserUUID       string    `json:"userUuid"`
+	Status         string    `json:"status"`
+	LastTimeOnline time.Time `json:"lastTimeOnline"`
+}
+
+type presence struct {
+	connections int
+	lastSeen    time.Time   // last active heartbeat, connect or final disconnect
+	published   string      // state the other clients were last told about
+	pending     *time.Timer // debounced publish
+}
+
+var (
+	presenceMu sync.Mutex
+	presences  = make(map[string]*presence)
+)
+
+// state must be called with presenceMu held
+func (p *presence) state(now time.Time) string {
+	if p.connections == 0 {
+		return PresenceOffline
+	}
+	if now.Sub(p.lastSeen) > idleAfter {
+		return PresenceIdle
+	}
+	return PresenceOnline
+}
+
+// PresenceOf reports the current state of a user
+func PresenceOf(userUUID string) string {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+
+	p, ok := presences[userUUID]
+	if !ok {
+		return PresenceOffline
+	}
+	return p.state(time.Now())
+}
+
+func presenceConnected(userUUID string) {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+
+	p, ok := presences[userUUID]
+	if !ok {
+		p = &presence{published: PresenceOffline}
+		presences[userUUID] = p
+	}
+	p.connections++
+	p.lastSeen = time.Now()
+	schedulePresence(userUUID, p)
+}
+
+func presenceDisconnected(userUUID string) {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+
+	p, ok := presences[userUUID]
+	if !ok || p.connections == 0 {
+		return
+	}
+	p.connections--
+	if p.connections == 0 {
+		p.lastSeen = time.Now()
+	}
+	schedulePresence(userUUID, p)
+}
+
+// presenceHeartbeat records a client heartbeat, active is false when the user isn't interacting
+func presenceHeartbeat(userUUID string, active bool) {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+
+	p, ok := presences[userUUID]
+	if !ok || !active {
+		return
+	}
+	p.lastSeen = time.Now()
+	schedulePresence(userUUID, p)
+}
+
+// schedulePresence publishes the user's state once it has settled,
+// so connections that flap within the debounce window cause no events.
+// presenceMu must be held by the caller
+func schedulePresence(userUUID string, p *presence) {
+	if p.pending != nil {
+		return
+	}
+	p.pending = time.AfterFunc(presenceDebounce, func() {
+		publishPresence(userUUID, p)
+	})
+}
+
+func publishPresence(userUUID string, p *presence) {
+	presenceMu.Lock()
+	p.pending = nil
+	status := p.state(time.Now())
+	if status == p.published {
+		presenceMu.Unlock()
+		return
+	}
+	p.published = status
+	if status == PresenceOffline && presences[userUUID] == p {
+		delete(presences, userUUID)
+	}
+	event := PresenceEvent{
+		MsgType:        "presenceChanged",
+		UserUUID:       userUUID,
+		Status:         status,
+		LastTimeOnline: p.lastSeen,
+	}
+	presenceMu.Unlock()
+
+	Mu.Lock()
+	defer Mu.Unlock()
+	for uuid := range Clients {
+		if uuid == userUUID {
+			continue
+		}
+		sendToUser(uuid, event)
+	}
+}
+
+// HandlePresence periodically moves connected users without recent activity to idle, until ctx is done
+func HandlePresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceSweep)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		presenceMu.Lock()
+		for userUUID, p := range presences {
+			if p.state(now) != p.published {
+				schedulePresence(userUUID, p)
+			}
+		}
+		presenceMu.Unlock()
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"real-time-forum/utils"
+	"strconv"
+	"strings"
+)
+
+var (
+	requestLimiter *utils.RateLimiter // API requests per client address
+	messageLimiter *utils.RateLimiter // chat messages per user UUID
+)
+
+func useRateLimits(limits RateLimitSettings) {
+	requestLimiter = utils.NewRateLimiter(limits.Requests)
+	messageLimiter = utils.NewRateLimiter(limits.Messages)
+}
+
+// LimitRequests rejects API requests of a client address beyond the requests rate limit
+// with status 429, everything else is passed on to next
+func LimitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := requestLimiter.Allow(client); !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "Too many requests",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,330 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings of the server. Defaults are overridden by a JSON file, then by FORUM_* environment
+// variables and then by command line flags, see Load
+type Settings struct {
+	Server     ServerSettings    `json:"server"`
+	Database   DatabaseSettings  `json:"database"`
+	Session    SessionSettings   `json:"session"`
+	Paging     PagingSettings    `json:"paging"`
+	RateLimits RateLimitSettings `json:"rateLimits"`
+	Limits     validation.Limits `json:"limits"` // lengths of user input
+	Log        LogSettings       `json:"log"`
+}
+
+type ServerSettings struct {
+	Addr            string   `json:"addr"`
+	TLSCert         string   `json:"tlsCert"` // serves HTTPS when set together with TLSKey
+	TLSKey          string   `json:"tlsKey"`
+	ReadTimeout     Duration `json:"readTimeout"`     // reading a whole request, 0 for none
+	WriteTimeout    Duration `json:"writeTimeout"`    // writing a response, 0 for none. WebSockets set their own
+	IdleTimeout     Duration `json:"idleTimeout"`     // keeping an idle keep-alive connection, 0 for none
+	ShutdownTimeout Duration `json:"shutdownTimeout"` // waiting for requests and connections to finish on shutdown
+}
+
+type DatabaseSettings struct {
+	Path string `json:"path"`
+}
+
+type SessionSettings struct {
+	TTL            Duration `json:"ttl"`
+	CookieSecure   bool     `json:"cookieSecure"`   // only sent over HTTPS
+	CookieSameSite string   `json:"cookieSameSite"` // lax, strict or none
+}
+
+// Page sizes used when a request doesn't ask for one, and the largest it may ask for
+type PagingSettings struct {
+	MessagePageSize    int `json:"messagePageSize"`
+	MaxMessagePageSize int `json:"maxMessagePageSize"`
+	PostPageSize       int `json:"postPageSize"`
+	MaxPostPageSize    int `json:"maxPostPageSize"`
+	SearchPageSize     int `json:"searchPageSize"`
+	MaxSearchPageSize  int `json:"maxSearchPageSize"`
+	ReplyTreeDepth     int `json:"replyTreeDepth"` // reply levels loaded at once
+	MaxReplyTreeDepth  int `json:"maxReplyTreeDepth"`
+	ReplyPageSize      int `json:"replyPageSize"` // replies loaded per comment
+	MaxReplyPageSize   int `json:"maxReplyPageSize"`
+}
+
+// Rate limits per minute, 0 turns a limit off
+type RateLimitSettings struct {
+	Requests int `json:"requests"` // API requests of a client address
+	Messages int `json:"messages"` // chat messages of a user
+}
+
+type LogSettings struct {
+	Level  string `json:"level"`  // debug, info, warn or error
+	Format string `json:"format"` // text or json
+}
+
+// Duration is a time.Duration written like "12h" or "90m" in the file, environment and flags
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// DefaultSettings are used for anything the file, environment and flags leave out
+func DefaultSettings() Settings {
+	return Settings{
+		Server: ServerSettings{
+			Addr:            ":8080",
+			ReadTimeout:     Duration{15 * time.Second},
+			WriteTimeout:    Duration{30 * time.Second},
+			IdleTimeout:     Duration{2 * time.Minute},
+			ShutdownTimeout: Duration{15 * time.Second},
+		},
+		Database: DatabaseSettings{Path: "./db/forum.db"},
+		Session: SessionSettings{
+			TTL:            Duration{12 * time.Hour},
+			CookieSameSite: "lax",
+		},
+		Paging: PagingSettings{
+			MessagePageSize:    10,
+			MaxMessagePageSize: 50,
+			PostPageSize:       20,
+			MaxPostPageSize:    50,
+			SearchPageSize:     20,
+			MaxSearchPageSize:  50,
+			ReplyTreeDepth:     3,
+			MaxReplyTreeDepth:  10,
+			ReplyPageSize:      10,
+			MaxReplyPageSize:   50,
+		},
+		RateLimits: RateLimitSettings{Requests: 600, Messages: 60},
+		Limits:     validation.DefaultLimits,
+		Log:        LogSettings{Level: "info", Format: "text"},
+	}
+}
+
+var current = DefaultSettings()
+
+// Current returns the settings in use
+func Current() Settings {
+	return current
+}
+
+// option is a setting that can also be given as an environment variable and a flag
+type option struct {
+	flag  string
+	value any // *string, *int, *bool or *Duration inside Settings
+	usage string
+}
+
+func (s *Settings) options() []option {
+	return []option{
+		{"addr", &s.Server.Addr, "address to listen on"},
+		{"tls-cert", &s.Server.TLSCert, "TLS certificate file, serves HTTPS together with -tls-key"},
+		{"tls-key", &s.Server.TLSKey, "TLS key file"},
+		{"read-timeout", &s.Server.ReadTimeout, "longest time to read a request, 0 for none"},
+		{"write-timeout", &s.Server.WriteTimeout, "longest time to write a response, 0 for none"},
+		{"idle-timeout", &s.Server.IdleTimeout, "how long idle keep-alive connections stay open, 0 for none"},
+		{"shutdown-timeout", &s.Server.ShutdownTimeout, "how long shutdown waits for requests and connections"},
+		{"db", &s.Database.Path, "path of the SQLite database"},
+		{"session-ttl", &s.Session.TTL, "how long a login lasts, e.g. 12h"},
+		{"cookie-secure", &s.Session.CookieSecure, "only send the session cookie over HTTPS"},
+		{"cookie-samesite", &s.Session.CookieSameSite, "SameSite of the session cookie: lax, strict or none"},
+		{"message-page-size", &s.Paging.MessagePageSize, "chat messages loaded at once"},
+		{"rate-requests", &s.RateLimits.Requests, "API requests per minute of a client, 0 for no limit"},
+		{"rate-messages", &s.RateLimits.Messages, "chat messages per minute of a user, 0 for no limit"},
+		{"title-max-len", &s.Limits.TitleMaxLen, "longest post title"},
+		{"content-max-len", &s.Limits.ContentMaxLen, "longest post or comment"},
+		{"log-level", &s.Log.Level, "lowest level logged: debug, info, warn or error"},
+		{"log-format", &s.Log.Format, "log line format: text or json"},
+	}
+}
+
+// envName is the environment variable of a flag, -session-ttl is FORUM_SESSION_TTL
+func envName(flag string) string {
+	return "FORUM_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+func setOption(value any, text string) error {
+	switch v := value.(type) {
+	case *string:
+		*v = text
+	case *int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", text)
+		}
+		*v = b
+	case *Duration:
+		return v.UnmarshalText([]byte(text))
+	}
+	return nil
+}
+
+// Load reads the settings from the JSON file given by -config or FORUM_CONFIG, the environment and
+// the flags in args, each overriding the one before, and uses them once they're valid.
+// It returns the arguments after the flags
+func Load(args []string) ([]string, error) {
+	settings := DefaultSettings()
+	options := settings.options()
+
+	// Flags are parsed first to find the file, and applied last
+	flags := flag.NewFlagSet("forum", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("FORUM_CONFIG"), "JSON settings file (FORUM_CONFIG)")
+	given := map[string]string{}
+	for _, opt := range options {
+		name := opt.flag
+		usage := fmt.Sprintf("%s (%s)", opt.usage, envName(name))
+		if value := reflect.ValueOf(opt.value).Elem(); !value.IsZero() {
+			usage = fmt.Sprintf("%s (default %v, %s)", opt.usage, value, envName(name))
+		}
+		remember := func(text string) error {
+			given[name] = text
+			return nil
+		}
+		if _, ok := opt.value.(*bool); ok {
+			flags.BoolFunc(name, usage, remember)
+		} else {
+			flags.Func(name, usage, remember)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		file, err := os.Open(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&settings); err != nil {
+			return nil, fmt.Errorf("%s: %v", *configPath, err)
+		}
+	}
+
+	for _, opt := range options {
+		text, fromEnv := os.LookupEnv(envName(opt.flag))
+		if flagText, ok := given[opt.flag]; ok {
+			text = flagText
+		} else if !fromEnv {
+			continue
+		}
+		if err := setOption(opt.value, text); err != nil {
+			return nil, fmt.Errorf("%s: %v", opt.flag, err)
+		}
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	current = settings
+	useRateLimits(settings.RateLimits)
+	useLogging(settings.Log)
+	return flags.Args(), nil
+}
+
+// Validate reports every setting that can't be used
+func (s Settings) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(s.Server.Addr != "", "addr is empty")
+	check((s.Server.TLSCert == "") == (s.Server.TLSKey == ""), "tls-cert and tls-key have to be set together")
+	check(s.Server.ReadTimeout.Duration >= 0, "read-timeout can't be negative")
+	check(s.Server.WriteTimeout.Duration >= 0, "write-timeout can't be negative")
+	check(s.Server.IdleTimeout.Duration >= 0, "idle-timeout can't be negative")
+	check(s.Server.ShutdownTimeout.Duration > 0, "shutdown-timeout has to be positive")
+	check(s.Database.Path != "", "db is empty")
+	check(s.Session.TTL.Duration > 0, "session-ttl has to be positive")
+	_, sameSiteOK := sameSiteModes[strings.ToLower(s.Session.CookieSameSite)]
+	check(sameSiteOK, "cookie-samesite %q is not lax, strict or none", s.Session.CookieSameSite)
+	check(!strings.EqualFold(s.Session.CookieSameSite, "none") || s.Session.CookieSecure,
+		"cookie-samesite none needs cookie-secure")
+
+	pageSize := func(name string, size int, max int) {
+		check(size > 0 && size <= max, "%s has to be between 1 and its maximum %d", name, max)
+	}
+	pageSize("messagePageSize", s.Paging.MessagePageSize, s.Paging.MaxMessagePageSize)
+	pageSize("postPageSize", s.Paging.PostPageSize, s.Paging.MaxPostPageSize)
+	pageSize("searchPageSize", s.Paging.SearchPageSize, s.Paging.MaxSearchPageSize)
+	pageSize("replyTreeDepth", s.Paging.ReplyTreeDepth, s.Paging.MaxReplyTreeDepth)
+	pageSize("replyPageSize", s.Paging.ReplyPageSize, s.Paging.MaxReplyPageSize)
+
+	check(s.RateLimits.Requests >= 0, "rate-requests can't be negative")
+	check(s.RateLimits.Messages >= 0, "rate-messages can't be negative")
+
+	limits := s.Limits
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"usernameMaxLen", limits.UsernameMaxLen}, {"nameMaxLen", limits.NameMaxLen}, {"emailMaxLen", limits.EmailMaxLen},
+		{"passwordMaxLen", limits.PasswordMaxLen}, {"maxAge", limits.MaxAge}, {"titleMaxLen", limits.TitleMaxLen},
+		{"contentMaxLen", limits.ContentMaxLen}, {"messageMaxLen", limits.MessageMaxLen},
+		{"categoryNameMaxLen", limits.CategoryNameMaxLen}, {"groupNameMaxLen", limits.GroupNameMaxLen},
+	} {
+		check(limit.value > 0, "limits.%s has to be positive", limit.name)
+	}
+	check(limits.UsernameMinLen <= limits.UsernameMaxLen, "limits.usernameMinLen is above usernameMaxLen")
+	check(limits.PasswordMinLen <= limits.PasswordMaxLen, "limits.passwordMinLen is above passwordMaxLen")
+	check(limits.PasswordMaxLen <= 72, "limits.passwordMaxLen can't be above 72, bcrypt ignores the rest")
+	check(limits.MinAge <= limits.MaxAge, "limits.minAge is above maxAge")
+
+	_, err := utils.ParseLogLevel(s.Log.Level)
+	check(err == nil, "log-level %q is not debug, info, warn or error", s.Log.Level)
+	check(strings.EqualFold(s.Log.Format, "text") || strings.EqualFold(s.Log.Format, "json"),
+		"log-format %q is not text or json", s.Log.Format)
+
+	return errors.Join(errs...)
+}
+
+// useLogging makes the logger of the settings the default of log/slog and log
+func useLogging(settings LogSettings) {
+	level, _ := utils.ParseLogLevel(settings.Level)
+	slog.SetDefault(utils.NewLogger(os.Stderr, level, settings.Format))
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// SameSite is the SameSite mode of the session cookie
+func (s SessionSettings) SameSite() http.SameSite {
+	return sameSiteModes[strings.ToLower(s.CookieSameSite)]
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	forumModels "real-time-forum/modules/forumManagement/models"
+	userModels "real-time-forum/modules/userManagement/models"
+	"sync"
+	"time"
+)
+
+const typingTimeout = 5 * time.Second // Typing stops on its own if the client never sends stopped_typing
+
+// TypingEvent tells chat members that a user started or stopped typing
+type TypingEvent struct {
+	MsgType  string `json:"msgType"`
+	UserFrom string `json:"userFrom"`
+	ChatUUID string `json:"chatUUID"`
+}
+
+type typingKey struct {
+	userUUID string
+	chatUUID string
+}
+
+type typingState struct {
+	recipients []string
+	timer      *time.Timer
+}
+
+var (
+	typingMu sync.Mutex
+	typing   = make(map[typingKey]*typingState)
+)
+
+// handleTyping validates a typing update and forwards it to the other chat members
+func handleTyping(client *Client, user userModels.User, msg InboundMessage) {
+	chatUUID := msg.ChatUUID
+	if chatUUID == "" && msg.To != "" {
+		// A direct chat addressed by the other user
+		otherID, err := userModels.Users.FindUserByUUID(msg.To)
+		if err != nil || otherID <= 0 {
+			return
+		}
+		chatUUID, err = forumModels.Chats.FindChatUUIDbyUserIDS(user.ID, otherID)
+		if err != nil {
+			client.log.Error("Error finding chat for typing", "err", err)
+			return
+		}
+	}
+	if chatUUID == "" {
+		return // No shared chat yet
+	}
+
+	key := typingKey{userUUID: client.UserUUID, chatUUID: chatUUID}
+	if msg.Type == "stopped_typing" {
+		stopTyping(key)
+		return
+	}
+
+	if recipients, ok := refreshTyping(key); ok {
+		sendTypingEvent("typing", key, recipients)
+		return
+	}
+
+	// Only members of the chat can type in it
+	chat, err := forumModels.Chats.ReadChatForMember(chatUUID, user.ID)
+	if err != nil {
+		return
+	}
+	recipients, err := forumModels.Chats.ReadChatMemberUUIDs(chat.ID, user.ID)
+	if err != nil {
+		client.log.Error("Error reading chat members for typing", "chat", chatUUID, "err", err)
+		return
+	}
+
+	startTyping(key, recipients)
+	sendTypingEvent("typing", key, recipients)
+}
+
+// refreshTyping extends a running typing state and returns its recipients
+func refreshTyping(key typingKey) ([]string, bool) {
+	typingMu.Lock()
+	defer typingMu.Unlock()
+
+	state, ok := typing[key]
+	if !ok || !state.timer.Stop() {
+		return nil, false // Not typing, or the expiry is already under way
+	}
+	state.timer.Reset(typingTimeout)
+	return state.recipients, true
+}
+
+func startTyping(key typingKey, recipients []string) {
+	typingMu.Lock()
+	defer typingMu.Unlock()
+
+	if old, ok := typing[key]; ok {
+		old.timer.Stop()
+	}
+	state := &typingState{recipients: recipients}
+	state.timer = time.AfterFunc(typingTimeout, func() {
+		expireTyping(key, state)
+	})
+	typing[key] = state
+}
+
+// expireTyping ends a typing state whose client went quiet
+func expireTyping(key typingKey, state *typingState) {
+	typingMu.Lock()
+	if typing[key] != state {
+		typingMu.Unlock()
+		return // Replaced by a newer state
+	}
+	delete(typing, key)
+	typingMu.Unlock()
+
+	sendTypingEvent("stopped_typing", key, state.recipients)
+}
+
+func stopTyping(key typingKey) {
+	typingMu.Lock()
+	state, ok := typing[key]
+	if !ok {
+		typingMu.Unlock()
+		return
+	}
+	state.timer.Stop()
+	delete(typing, key)
+	typingMu.Unlock()
+
+	sendTypingEvent("stopped_typing", key, state.recipients)
+}
+
+// stopAllTyping ends every typing state of the user, e.g. when they go offline
+func stopAllTyping(userUUID string) {
+	typingMu.Lock()
+	var keys []typingKey
+	for key := range typing {
+		if key.userUUID == userUUID {
+			keys = append(keys, key)
+		}
+	}
+	typingMu.Unlock()
+
+	for _, key := range keys {
+		stopTyping(key)
+	}
+}
+
+func sendTypingEvent(msgType string, key typingKey, recipients []string) {
+	event := TypingEvent{
+		MsgType:  msgType,
+		UserFrom: key.userUUID,
+		ChatUUID: key.chatUUID,
+	}
+
+	Mu.Lock()
+	defer Mu.Unlock()
+	for _, uuid := range recipients {
+		sendToUser(uuid, event)
+	}
+}
@@ -3,52 +3,57 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
 	"strings"
+	"time"
 )
 
-func OpenDBConnection() *sql.DB {
-	db, err := sql.Open("sqlite3", "./db/forum.db")
-	if err != nil {
-		log.Fatal(err)
-	}
+// Pool settings of the shared connection. SQLite has a single writer, so a few connections
+// are enough for concurrent readers and the rest wait for the busy timeout instead of failing
+const (
+	MaxOpenConns    = 8
+	MaxIdleConns    = 4
+	ConnMaxIdleTime = 5 * time.Minute
+	BusyTimeout     = 5 * time.Second
+)
 
-	// Enable foreign key constraints
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
+// Open opens the database at path once for the whole server. Foreign keys, WAL and the busy timeout
+// are set in the DSN so every connection of the pool gets them, not only the first one
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn(path, "_journal_mode=WAL"))
 	if err != nil {
-		log.Fatal("Failed to enable foreign key constraints:", err)
-	}
-	// Enable foreign key constraints
-	_, err = db.Exec("PRAGMA journal_mode=WAL;")
-	if err != nil {
-		log.Fatal("Failed to enable foreign key constraints:", err)
+		return nil, err
 	}
+	db.SetMaxOpenConns(MaxOpenConns)
+	db.SetMaxIdleConns(MaxIdleConns)
+	db.SetConnMaxIdleTime(ConnMaxIdleTime)
 
-	return db
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return db, nil
 }
 
-func ExecuteSQLFile(sqlFilePath string) error {
-	db := OpenDBConnection()
-	defer db.Close()
-
-	sqlBytes, err := os.ReadFile(sqlFilePath)
+// OpenMemory opens an empty in-memory database, for running handlers in tests.
+// Every connection to :memory: is a database of its own, so the pool keeps a single one
+func OpenMemory() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn(":memory:"))
 	if err != nil {
-		return fmt.Errorf("failed to read SQL file: %v", err)
-	}
-
-	sqlStatements := strings.Split(string(sqlBytes), ";")
-
-	for _, stmt := range sqlStatements {
-		trimmedStmt := strings.TrimSpace(stmt)
-		if trimmedStmt == "" {
-			continue
-		}
-		_, err := db.Exec(trimmedStmt)
-		if err != nil {
-			return fmt.Errorf("error executing statement: %v", err)
-		}
+		return nil, err
 	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+	return db, db.Ping()
+}
 
-	return nil
+// dsn adds the settings every connection needs to path. Transactions take the write lock
+// when they begin, so two of them can't deadlock upgrading from read to write
+func dsn(path string, params ...string) string {
+	params = append(params,
+		"_foreign_keys=on",
+		fmt.Sprintf("_busy_timeout=%d", BusyTimeout.Milliseconds()),
+		"_txlock=immediate",
+	)
+	return "file:" + path + "?" + strings.Join(params, "&")
 }
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS "comment_likes";
+DROP TABLE IF EXISTS "post_likes";
+DROP TABLE IF EXISTS "comments";
+DROP TABLE IF EXISTS "post_categories";
+DROP TABLE IF EXISTS "posts";
+DROP TABLE IF EXISTS "categories";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "messages";
+DROP TABLE IF EXISTS "chats";
+DROP TABLE IF EXISTS "users";
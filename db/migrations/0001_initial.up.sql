@@ -0,0 +1,149 @@
+-- Schema of the forum before migrations were introduced, databases created from forum.sql start here
+
+CREATE TABLE "categories" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "name" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "created_by" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (created_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+CREATE TABLE "users" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "type" TEXT NOT NULL CHECK ("type" IN ('admin', 'normal_user', 'test_user')) DEFAULT 'normal_user',
+	"username" TEXT UNIQUE NOT NULL,
+	"age" INTEGER NOT NULL,
+	"gender" TEXT NOT NULL,
+	"firstname" TEXT NOT NULL,
+	"lastname" TEXT NOT NULL,
+	"email" TEXT UNIQUE NOT NULL,
+	"password" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "last_time_online" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+
+CREATE TABLE "chats" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "user_id_1" INTEGER NOT NULL,
+  "user_id_2" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id_1) REFERENCES "users" ("id"),
+  FOREIGN KEY (user_id_2) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  CONSTRAINT unique_chat UNIQUE (user_id_1, user_id_2) 
+);
+
+CREATE TABLE "messages" (
+  "id" INTEGER PRIMARY KEY,
+  "chat_id" INTEGER NOT NULL,
+  "user_id_from" INTEGER NOT NULL,
+  "content" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  FOREIGN KEY (chat_id) REFERENCES "chats" ("id"),
+  FOREIGN KEY (user_id_from) REFERENCES "users" ("id")
+);
+
+
+CREATE TABLE "posts" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "title" TEXT NOT NULL,
+  "description" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "user_id" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+CREATE TABLE "post_likes" (
+  "id" INTEGER PRIMARY KEY,
+  "type" TEXT NOT NULL CHECK ("type" IN ('like', 'dislike')),
+  "post_id" INTEGER NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (post_id) REFERENCES "posts" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+CREATE TABLE "post_categories" (
+  "id" INTEGER PRIMARY KEY,
+  "post_id" INTEGER NOT NULL,
+  "category_id" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "created_by" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (created_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (post_id) REFERENCES "posts" ("id"),
+  FOREIGN KEY (category_id) REFERENCES "categories" ("id")
+);
+
+CREATE TABLE "comments" (
+  "id" INTEGER PRIMARY KEY,
+  "post_id" INTEGER DEFAULT NULL,
+  "comment_id" INTEGER DEFAULT NULL,
+  "description" TEXT NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (post_id) REFERENCES "posts" ("id") ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES "comments" ("id") ON DELETE CASCADE,
+  CHECK (
+    (post_id IS NOT NULL AND comment_id IS NULL) OR
+    (post_id IS NULL AND comment_id IS NOT NULL)
+  )
+);
+
+CREATE TABLE "comment_likes" (
+  "id" INTEGER PRIMARY KEY,
+  "type" TEXT NOT NULL,
+  "comment_id" INTEGER NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (comment_id) REFERENCES "comments" ("id")
+);
+
+
+
+CREATE TABLE "sessions" (
+  "id" INTEGER PRIMARY KEY,
+  "session_token" TEXT NOT NULL UNIQUE,
+  "user_id" INTEGER NOT NULL,
+  "expires_at" DATETIME NOT NULL,
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id")
+);
@@ -0,0 +1,4 @@
+DROP INDEX "idx_messages_chat_id_id";
+
+ALTER TABLE "messages" DROP COLUMN "read_at";
+ALTER TABLE "messages" DROP COLUMN "delivered_at";
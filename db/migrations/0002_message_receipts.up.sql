@@ -0,0 +1,5 @@
+-- Delivery and read receipts of private messages, and paging through a chat's history by id
+ALTER TABLE "messages" ADD COLUMN "delivered_at" DATETIME;
+ALTER TABLE "messages" ADD COLUMN "read_at" DATETIME;
+
+CREATE INDEX "idx_messages_chat_id_id" ON "messages" ("chat_id", "id");
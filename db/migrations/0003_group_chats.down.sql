@@ -0,0 +1,27 @@
+-- Direct chats only, group chats and their messages are removed
+DROP TABLE "chat_members";
+
+DELETE FROM "messages" WHERE chat_id IN (SELECT id FROM "chats" WHERE type = 'group');
+
+CREATE TABLE "chats_old" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "user_id_1" INTEGER NOT NULL,
+  "user_id_2" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id_1) REFERENCES "users" ("id"),
+  FOREIGN KEY (user_id_2) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  CONSTRAINT unique_chat UNIQUE (user_id_1, user_id_2)
+);
+
+INSERT INTO "chats_old" (id, uuid, user_id_1, user_id_2, status, created_at, updated_at, updated_by)
+SELECT id, uuid, user_id_1, user_id_2, status, created_at, updated_at, updated_by
+FROM "chats"
+WHERE type = 'direct';
+
+DROP TABLE "chats";
+ALTER TABLE "chats_old" RENAME TO "chats";
@@ -0,0 +1,56 @@
+-- Group chats. A chat has a type and name, direct chats keep their two users and
+-- every chat lists its members with how far each of them has read
+CREATE TABLE "chats_new" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "type" TEXT NOT NULL CHECK ("type" IN ('direct', 'group')) DEFAULT 'direct',
+  "name" TEXT,
+  "user_id_1" INTEGER,
+  "user_id_2" INTEGER,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "created_by" INTEGER,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id_1) REFERENCES "users" ("id"),
+  FOREIGN KEY (user_id_2) REFERENCES "users" ("id"),
+  FOREIGN KEY (created_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id"),
+  CONSTRAINT unique_chat UNIQUE (user_id_1, user_id_2),
+  CONSTRAINT direct_chat_users CHECK ("type" = 'group' OR ("user_id_1" IS NOT NULL AND "user_id_2" IS NOT NULL))
+);
+
+INSERT INTO "chats_new" (id, uuid, type, user_id_1, user_id_2, status, created_at, created_by, updated_at, updated_by)
+SELECT id, uuid, 'direct', user_id_1, user_id_2, status, created_at, user_id_1, updated_at, updated_by
+FROM "chats";
+
+DROP TABLE "chats";
+ALTER TABLE "chats_new" RENAME TO "chats";
+
+CREATE TABLE "chat_members" (
+  "id" INTEGER PRIMARY KEY,
+  "chat_id" INTEGER NOT NULL,
+  "user_id" INTEGER NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "last_read_message_id" INTEGER NOT NULL DEFAULT 0,
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" DATETIME,
+  FOREIGN KEY (chat_id) REFERENCES "chats" ("id"),
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  CONSTRAINT unique_chat_member UNIQUE (chat_id, user_id)
+);
+
+CREATE INDEX "idx_chat_members_user_id" ON "chat_members" ("user_id");
+
+-- Both users of a direct chat are its members, they have read up to the last message
+-- the other one sent that has a read receipt
+INSERT INTO "chat_members" (chat_id, user_id, last_read_message_id)
+SELECT c.chat_id, c.user_id, COALESCE((
+    SELECT MAX(m.id) FROM "messages" m
+    WHERE m.chat_id = c.chat_id AND m.user_id_from != c.user_id AND m.read_at IS NOT NULL
+  ), 0)
+FROM (
+  SELECT id AS chat_id, user_id_1 AS user_id FROM "chats"
+  UNION ALL
+  SELECT id, user_id_2 FROM "chats"
+) c;
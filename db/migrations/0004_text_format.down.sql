@@ -0,0 +1,3 @@
+ALTER TABLE "messages" DROP COLUMN "format";
+ALTER TABLE "comments" DROP COLUMN "format";
+ALTER TABLE "posts" DROP COLUMN "format";
@@ -0,0 +1,4 @@
+-- Posts, comments and messages are written as plain text or Markdown
+ALTER TABLE "posts" ADD COLUMN "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain';
+ALTER TABLE "comments" ADD COLUMN "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain';
+ALTER TABLE "messages" ADD COLUMN "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain';
@@ -0,0 +1,23 @@
+-- Drafts that were never published are kept as deleted posts
+CREATE TABLE "posts_old" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "title" TEXT NOT NULL,
+  "description" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "user_id" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain',
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+INSERT INTO "posts_old" (id, uuid, title, description, status, created_at, user_id, updated_at, updated_by, format)
+SELECT id, uuid, title, description, CASE status WHEN 'draft' THEN 'delete' ELSE status END,
+  created_at, user_id, updated_at, updated_by, format
+FROM "posts";
+
+DROP TABLE "posts";
+ALTER TABLE "posts_old" RENAME TO "posts";
@@ -0,0 +1,25 @@
+-- Posts can be saved as drafts and scheduled to be published later
+CREATE TABLE "posts_new" (
+  "id" INTEGER PRIMARY KEY,
+  "uuid" TEXT NOT NULL UNIQUE,
+  "title" TEXT NOT NULL,
+  "description" TEXT NOT NULL,
+  "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain',
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete', 'draft')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "publish_at" DATETIME,
+  "user_id" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (user_id) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+INSERT INTO "posts_new" (id, uuid, title, description, format, status, created_at, user_id, updated_at, updated_by)
+SELECT id, uuid, title, description, format, status, created_at, user_id, updated_at, updated_by
+FROM "posts";
+
+DROP TABLE "posts";
+ALTER TABLE "posts_new" RENAME TO "posts";
+
+CREATE INDEX "idx_posts_status_publish_at" ON "posts" ("status", "publish_at");
@@ -0,0 +1,14 @@
+-- Earlier versions of edited posts and comments, the current version stays in its own table
+CREATE TABLE "revisions" (
+  "id" INTEGER PRIMARY KEY,
+  "kind" TEXT NOT NULL CHECK ("kind" IN ('post', 'comment')),
+  "ref_id" INTEGER NOT NULL,
+  "title" TEXT NOT NULL DEFAULT '',
+  "description" TEXT NOT NULL,
+  "format" TEXT NOT NULL CHECK ("format" IN ('plain', 'markdown')) DEFAULT 'plain',
+  "created_at" DATETIME NOT NULL,
+  "created_by" INTEGER NOT NULL,
+  FOREIGN KEY (created_by) REFERENCES "users" ("id")
+);
+
+CREATE INDEX "idx_revisions_kind_ref_id" ON "revisions" ("kind", "ref_id", "id");
@@ -0,0 +1,4 @@
+-- search_fts is created by the server when SQLite has FTS5, dropping it needs FTS5 as well
+DROP TABLE IF EXISTS "search_fts";
+DROP TABLE "search_index_state";
+DROP TABLE "search_documents";
@@ -0,0 +1,23 @@
+-- Searchable plain text of the enabled posts and comments, kept up to date by the models.
+-- Every row carries the post of its thread. With FTS5 the server indexes the rows in search_fts
+CREATE TABLE "search_documents" (
+  "id" INTEGER PRIMARY KEY,
+  "kind" TEXT NOT NULL CHECK ("kind" IN ('post', 'comment')),
+  "ref_id" INTEGER NOT NULL,
+  "post_id" INTEGER NOT NULL,
+  "title" TEXT NOT NULL,
+  "body" TEXT NOT NULL,
+  UNIQUE ("kind", "ref_id"),
+  FOREIGN KEY (post_id) REFERENCES "posts" ("id")
+);
+
+-- stale is set when posts or comments were written around the models, e.g. by seeds, and
+-- fts_synced is cleared while a build without FTS5 writes the documents. The server rebuilds
+-- what's out of date when it starts, the documents are filled by that first start
+CREATE TABLE "search_index_state" (
+  "id" INTEGER PRIMARY KEY CHECK ("id" = 1),
+  "stale" BOOLEAN NOT NULL DEFAULT 0,
+  "fts_synced" BOOLEAN NOT NULL DEFAULT 0
+);
+
+INSERT INTO "search_index_state" ("id", "stale", "fts_synced") VALUES (1, 1, 0);
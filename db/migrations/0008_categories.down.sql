@@ -0,0 +1,25 @@
+-- Categories added by the up migration are removed unless posts use them,
+-- the ones left without a creator are given the first user
+DELETE FROM "categories"
+WHERE created_by IS NULL
+  AND name IN ('art', 'science', 'news', 'sport', 'society', 'tech')
+  AND id NOT IN (SELECT category_id FROM "post_categories");
+
+CREATE TABLE "categories_old" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "name" TEXT NOT NULL,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "created_by" INTEGER NOT NULL,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (created_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+INSERT INTO "categories_old" (id, name, status, created_at, created_by, updated_at, updated_by)
+SELECT id, name, status, created_at, COALESCE(created_by, (SELECT MIN(id) FROM "users")), updated_at, updated_by
+FROM "categories";
+
+DROP TABLE "categories";
+ALTER TABLE "categories_old" RENAME TO "categories";
@@ -0,0 +1,23 @@
+-- Categories are reference data every database needs, not development fixtures.
+-- The ones created by migrations have no creator, and names are unique so they're only added once
+CREATE TABLE "categories_new" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "name" TEXT NOT NULL UNIQUE,
+  "status" TEXT NOT NULL CHECK ("status" IN ('enable', 'disable', 'delete')) DEFAULT 'enable',
+  "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "created_by" INTEGER,
+  "updated_at" DATETIME,
+  "updated_by" INTEGER,
+  FOREIGN KEY (created_by) REFERENCES "users" ("id"),
+  FOREIGN KEY (updated_by) REFERENCES "users" ("id")
+);
+
+INSERT INTO "categories_new" (id, name, status, created_at, created_by, updated_at, updated_by)
+SELECT id, name, status, created_at, created_by, updated_at, updated_by
+FROM "categories";
+
+DROP TABLE "categories";
+ALTER TABLE "categories_new" RENAME TO "categories";
+
+INSERT OR IGNORE INTO "categories" (name) VALUES
+('art'), ('science'), ('news'), ('sport'), ('society'), ('tech');
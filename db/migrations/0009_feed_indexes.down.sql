@@ -0,0 +1,4 @@
+DROP INDEX "idx_post_likes_post_id";
+DROP INDEX "idx_comments_comment_id";
+DROP INDEX "idx_comments_post_id";
+DROP INDEX "idx_posts_status_created_at";
@@ -0,0 +1,6 @@
+-- The newest posts are read in index order, and the counts the other sorts of the feed
+-- rank by, including the reply trees of deleted comments, are index lookups
+CREATE INDEX "idx_posts_status_created_at" ON "posts" ("status", "created_at");
+CREATE INDEX "idx_comments_post_id" ON "comments" ("post_id");
+CREATE INDEX "idx_comments_comment_id" ON "comments" ("comment_id");
+CREATE INDEX "idx_post_likes_post_id" ON "post_likes" ("post_id");
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+)
+
+//go:embed seeds/*.sql
+var seedFiles embed.FS
+
+// ErrNotEmpty is returned by Seed when the database already has users
+var ErrNotEmpty = errors.New("database already has users, seeds only go into a new database")
+
+// Seed fills a new database with the development fixtures from seeds/dev.sql, the schema has to be migrated up to date first
+func Seed(db *sql.DB) error {
+	var users int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users;`).Scan(&users); err != nil {
+		return err
+	}
+	if users > 0 {
+		return ErrNotEmpty
+	}
+
+	script, err := fs.ReadFile(seedFiles, "seeds/dev.sql")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(script)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"real-time-forum/config"
 	"real-time-forum/db"
 	forumManagementControllers "real-time-forum/modules/forumManagement/controllers"
+	forumModels "real-time-forum/modules/forumManagement/models"
 	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/validation"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func MakeTemplate() {
@@ -28,7 +40,7 @@ func SetHandlers() {
 	})
 	http.HandleFunc("/", config.HomeHandler)
 
-	go config.HandleBroadcasts()
+	config.Start()
 
 	http.HandleFunc("/api/category", forumManagementControllers.CategoryHandler)
 	http.HandleFunc("/api/session", userManagementControllers.HandleSessionCheck)
@@ -37,22 +49,141 @@ func SetHandlers() {
 	http.HandleFunc("/api/logout", userManagementControllers.HandleLogout)
 	http.HandleFunc("/ws", config.HandleConnections)
 	http.HandleFunc("/api/posts", forumManagementControllers.HandlePosts)
+	http.HandleFunc("/api/posts/", forumManagementControllers.ReadPost)
+	http.HandleFunc("/api/drafts", forumManagementControllers.HandleDrafts)
+	http.HandleFunc("/api/drafts/publish", forumManagementControllers.PublishDraftHandler)
 	http.HandleFunc("/api/like", forumManagementControllers.LikeHandler)
 	http.HandleFunc("/api/dislike", forumManagementControllers.DislikeHandler)
 	http.HandleFunc("/api/addreply", forumManagementControllers.ReplyHandler)
+	http.HandleFunc("/api/editreply", forumManagementControllers.EditReplyHandler)
+	http.HandleFunc("/api/deletereply", forumManagementControllers.DeleteReplyHandler)
 	http.HandleFunc("/api/replies", forumManagementControllers.GetRepliesHandler)
+	http.HandleFunc("/api/revisions", forumManagementControllers.RevisionsHandler)
+	http.HandleFunc("/api/revisions/diff", forumManagementControllers.RevisionDiffHandler)
 	http.HandleFunc("/api/sendmessage", forumManagementControllers.SendMessageHandler)
 	http.HandleFunc("/api/showmessages", forumManagementControllers.ShowMessagesHandler)
+	http.HandleFunc("/api/markread", forumManagementControllers.MarkReadHandler)
+	http.HandleFunc("/api/editmessage", forumManagementControllers.EditMessageHandler)
+	http.HandleFunc("/api/deletemessage", forumManagementControllers.DeleteMessageHandler)
+	http.HandleFunc("/api/creategroup", forumManagementControllers.CreateGroupHandler)
+	http.HandleFunc("/api/renamegroup", forumManagementControllers.RenameGroupHandler)
+	http.HandleFunc("/api/addgroupmembers", forumManagementControllers.AddGroupMembersHandler)
+	http.HandleFunc("/api/leavegroup", forumManagementControllers.LeaveGroupHandler)
+	http.HandleFunc("/api/search", forumManagementControllers.SearchHandler)
 	http.HandleFunc("/api/userslist", forumManagementControllers.GetUsersHandler)
 	http.HandleFunc("/api/myprofile", userManagementControllers.HandleMyProfile)
 }
 
 func main() {
-	db.ExecuteSQLFile("db/forum.sql")
+	args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Println("Invalid settings:", err.Error())
+		os.Exit(1)
+	}
+	settings := config.Current()
+	validation.SetLimits(settings.Limits)
+
+	database, err := db.Open(settings.Database.Path)
+	if err != nil {
+		slog.Error("Error opening database", "err", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+	forumModels.Use(database)
+	userModels.Use(database)
+
+	if len(args) > 0 {
+		if err := runCommand(database, args); err != nil {
+			fmt.Println("Error:", err.Error())
+			database.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Pending migrations are applied on every start, the development fixtures only by the seed command
+	applied, err := db.MigrateUp(database)
+	if len(applied) > 0 {
+		printMigrations("Applied", applied)
+	}
+	if err != nil {
+		slog.Error("Error migrating database", "err", err)
+		os.Exit(1)
+	}
+	rebuilt, err := forumModels.SearchIndex.RefreshSearchIndex()
+	if err != nil {
+		slog.Error("Error rebuilding search index", "err", err)
+		os.Exit(1)
+	}
+	if rebuilt {
+		slog.Info("Rebuilt stale search index")
+	}
+	if !forumModels.FullTextSearch() {
+		slog.Warn("SQLite is built without FTS5, search falls back to LIKE")
+	}
 	
 
 	SetHandlers()
 	MakeTemplate()
-	fmt.Println("Server is running at http://localhost:8080")
-	http.ListenAndServe(":8080", nil)
+	server := &http.Server{
+		Addr:         settings.Server.Addr,
+		Handler:      config.LogRequests(config.LimitRequests(http.DefaultServeMux)),
+		ReadTimeout:  settings.Server.ReadTimeout.Duration,
+		WriteTimeout: settings.Server.WriteTimeout.Duration,
+		IdleTimeout:  settings.Server.IdleTimeout.Duration,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() {
+		if settings.Server.TLSCert != "" {
+			slog.Info("Server is running", "url", serverURL("https", server.Addr))
+			served <- server.ListenAndServeTLS(settings.Server.TLSCert, settings.Server.TLSKey)
+		} else {
+			slog.Info("Server is running", "url", serverURL("http", server.Addr))
+			served <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-served:
+		slog.Error("Server stopped", "err", err)
+		database.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// A second signal stops the server right away
+	stop()
+	slog.Info("Shutting down")
+	shutdown(server, database, settings.Server.ShutdownTimeout.Duration)
+	slog.Info("Server stopped")
+}
+
+// shutdown stops taking requests, closes the WebSocket connections and the hub and then closes the
+// database, waiting at most timeout for requests and connections to finish
+func shutdown(server *http.Server, database *sql.DB, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping HTTP server", "err", err)
+	}
+	if err := config.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping WebSocket hub", "err", err)
+	}
+	if err := database.Close(); err != nil {
+		slog.Error("Error closing database", "err", err)
+	}
+}
+
+// serverURL is where the server listening on addr can be opened, localhost when it listens on all addresses
+func serverURL(scheme string, addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return scheme + "://" + addr
 }
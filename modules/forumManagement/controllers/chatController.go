@@ -1,14 +1,19 @@
 package controller
 
 import (
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
 	"real-time-forum/config"
 	"real-time-forum/modules/forumManagement/models"
 	userManagementControllers "real-time-forum/modules/userManagement/controllers"
 	userModels "real-time-forum/modules/userManagement/models"
-	"time"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
+	"strconv"
+	"strings"
 )
 
 func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,9 +28,9 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var err error
 	var msg config.Message
-	msg.ChattedUsers, msg.UnchattedUsers, err = models.ReadAllUsers(user.ID)
+	msg.ChattedUsers, msg.UnchattedUsers, err = models.Chats.ReadAllUsers(user.ID)
 	if err != nil {
-		fmt.Println("Error getting list of users:", err.Error())
+		slog.ErrorContext(r.Context(), "Error getting list of users", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -35,15 +40,13 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for i, usr := range msg.ChattedUsers {
-		if _, ok := config.Clients[usr.UserUUID]; ok {
-			msg.ChattedUsers[i].IsOnline = true
-		}
+		msg.ChattedUsers[i].Presence = config.PresenceOf(usr.UserUUID)
+		msg.ChattedUsers[i].IsOnline = msg.ChattedUsers[i].Presence != config.PresenceOffline
 	}
 
 	for i, usr := range msg.UnchattedUsers {
-		if _, ok := config.Clients[usr.UserUUID]; ok {
-			msg.UnchattedUsers[i].IsOnline = true
-		}
+		msg.UnchattedUsers[i].Presence = config.PresenceOf(usr.UserUUID)
+		msg.UnchattedUsers[i].IsOnline = msg.UnchattedUsers[i].Presence != config.PresenceOffline
 	}
 
 	msg.MsgType = "listOfChat"
@@ -62,8 +65,6 @@ func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	loginStatus, sendUser, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
-	var msg config.Message
-
 	if !loginStatus || validateErr != nil {
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -73,115 +74,147 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	reciverUserUUID := r.URL.Query().Get("UserUUID")
-	_, exists := config.Clients[reciverUserUUID]
-	if !exists {
+	chatUUID := r.URL.Query().Get("ChatUUID")
+
+	var dataReq struct {
+		Content  string `json:"content"`
+		Markdown bool   `json:"markdown"` // opt in to rendering the content as Markdown
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
-			"success": true,
-			"message": "user is offline try later",
+			"success": false,
 		})
 		return
 	}
 
-	chatUUID := r.URL.Query().Get("ChatUUID")
+	sent, err := config.SendChatMessage(sendUser, chatUUID, reciverUserUUID, dataReq.Content, utils.FormatFor(dataReq.Markdown))
+	if err != nil {
+		writeChatError(w, r, "SendChatMessage error at sendMessageHandler", err)
+		return
+	}
 
-	if chatUUID == "" {
-		reciverID, err := userModels.FindUserByUUID(reciverUserUUID)
-		if err != nil {
-			fmt.Println("find user : ", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]any{
-				"success": false,
-			})
-			return
-		}
+	responseMessage := "Chat message stored for offline delivery"
+	if sent.Delivered {
+		responseMessage = "Chat message sent"
+	}
 
-		// Double check for chat with both user IDs (If two users open chat before any message is sent)
-		chatUUID, err = models.FindChatUUIDbyUserIDS(sendUser.ID, reciverID)
-
-		if chatUUID == "" && err == nil {
-			chatUUID, err = models.InsertChat(sendUser.ID, reciverID)
-			if err != nil {
-				fmt.Println("create chat: ", err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]any{
-					"success": false,
-				})
-				return
-			}
-		} else if err != nil {
-			fmt.Println("find chat: ", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]any{
-				"success": false,
-			})
-			return
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":   true,
+		"message":   responseMessage,
+		"messageId": sent.MessageID,
+		"chatUUID":  sent.ChatUUID,
+		"createdAt": sent.CreatedAt,
+	})
+}
+
+func ShowMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
 	}
 
+	chatUUID := r.URL.Query().Get("ChatUUID")
 	var dataReq struct {
-		Content string `json:"content"`
+		Limit  int `json:"limit"`
+		Before int `json:"before"` // message ID to page back from
+		After  int `json:"after"`  // message ID to catch up from, e.g. after a reconnect
 	}
-
 	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
-		fmt.Println("decoding json at sendMessageHandler: ", err)
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
+			"message": "Error decoding JSON",
 		})
 		return
 	}
 
-	if dataReq.Content == "" {
-		fmt.Println("Empty message attempt")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+	msg, err := config.LoadHistory(user, chatUUID, r.URL.Query().Get("UserUUID"), dataReq.Limit, dataReq.Before, dataReq.After)
+	if err != nil {
+		writeChatError(w, r, "Error reading messages", err)
+		return
+	}
+
+	config.Broadcast <- msg
+
+	// Loading the chat means the user has seen its messages
+	if chatUUID != "" {
+		if err := config.MarkChatRead(chatUUID, user); err != nil {
+			slog.ErrorContext(r.Context(), "Error marking chat read", "chat", chatUUID, "err", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
+}
+
+func MarkReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
-			"message": "Empty message not accepted",
+			"message": "Method not allowed",
 		})
 		return
 	}
 
-	err := models.InsertMessage(dataReq.Content, sendUser.ID, chatUUID)
-	if err != nil {
-		fmt.Println("InsertMessage error at sendMessageHandler", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
+			"message": "Not logged in",
 		})
 		return
 	}
 
-	msg.MsgType = "sendMessage"
-	msg.Updated = false
-	msg.UserUUID = sendUser.UUID
-	msg.PrivateMessage.Message.CreatedAt = time.Now()
-	msg.PrivateMessage.Message.SenderUsername = sendUser.Username
-	msg.PrivateMessage.Message.Content = dataReq.Content
-	msg.PrivateMessage.Message.ChatUUID = chatUUID
-	msg.ReciverUserUUID = reciverUserUUID
-	msg.PrivateMessage.IsCreatedBy = true // change when sent to other user at Broadcast handler
+	chatUUID := r.URL.Query().Get("ChatUUID")
+	if chatUUID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing chat",
+		})
+		return
+	}
 
-	config.Broadcast <- msg
+	if err := config.MarkChatRead(chatUUID, user); err != nil {
+		writeChatError(w, r, "Error marking chat read", err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"success": true,
-		"message": "Chat message sent",
 	})
 }
 
-func ShowMessagesHandler(w http.ResponseWriter, r *http.Request) {
+func EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
 	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
-	var msg config.Message
 	if !loginStatus || validateErr != nil {
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -190,58 +223,182 @@ func ShowMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg.MsgType = "showMessages"
-	msg.Updated = false
-	msg.UserUUID = user.UUID
-	chatUUID := r.URL.Query().Get("ChatUUID")
-	msg.ReciverUserUUID = r.URL.Query().Get("UserUUID")
+	messageID, err := strconv.Atoi(r.URL.Query().Get("MessageID"))
+	if err != nil || messageID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid message",
+		})
+		return
+	}
+
 	var dataReq struct {
-		NumberOfMessages int `json:"numberOfMessages"`
+		Content  string `json:"content"`
+		Markdown bool   `json:"markdown"` // opt in to rendering the content as Markdown
 	}
+
 	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
-		fmt.Println(r.Body, err)
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
-			"message": "Error decoding JSON",
 		})
 		return
 	}
 
-	var err error
-	msg.Messages, err = models.ReadAllMessages(chatUUID, dataReq.NumberOfMessages, user.ID)
-	if err != nil {
-		fmt.Println("Error reading messages", err.Error())
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := validation.Message(dataReq.Content); err != nil {
+		validation.WriteErrors(w, err)
+		return
+	}
+	dataReq.Content = strings.TrimSpace(dataReq.Content)
+
+	if err := models.Chats.UpdateMessageContent(messageID, dataReq.Content, utils.FormatFor(dataReq.Markdown), user.ID); err != nil {
+		writeMessageChangeError(w, r, "UpdateMessageContent error at editMessageHandler", err)
+		return
+	}
+
+	if err := broadcastMessageChange("messageEdited", messageID, user); err != nil {
+		slog.ErrorContext(r.Context(), "Error broadcasting messageEdited", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"message": "Chat message edited",
+	})
+}
+
+func DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
+			"message": "Method not allowed",
 		})
 		return
 	}
 
-	// Write down if all the messages requested came through
-	if len(msg.Messages) == dataReq.NumberOfMessages {
-		msg.GotAllMessagesRequested = true
-	}
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
-	msg.ReceiverUserName, err = userModels.FindUsername(msg.ReciverUserUUID)
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
 
-	if err != nil {
-		fmt.Println("Error finding username", err.Error())
+	messageID, err := strconv.Atoi(r.URL.Query().Get("MessageID"))
+	if err != nil || messageID <= 0 {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
+			"message": "Invalid message",
 		})
 		return
 	}
 
-	config.Broadcast <- msg
+	if err := models.Chats.UpdateMessageStatus(messageID, "delete", user.ID); err != nil {
+		writeMessageChangeError(w, r, "UpdateMessageStatus error at deleteMessageHandler", err)
+		return
+	}
+
+	if err := broadcastMessageChange("messageDeleted", messageID, user); err != nil {
+		slog.ErrorContext(r.Context(), "Error broadcasting messageDeleted", "err", err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"success": true,
+		"message": "Chat message deleted",
+	})
+}
+
+// writeMessageChangeError answers a failed edit or delete, messages that are
+// not the user's own (or already deleted) are reported as not found
+func writeMessageChangeError(w http.ResponseWriter, r *http.Request, logMessage string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Message not found",
+		})
+		return
+	}
+
+	slog.ErrorContext(r.Context(), logMessage, "err", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
 	})
 }
+
+// broadcastMessageChange pushes the updated message to every chat member
+func broadcastMessageChange(msgType string, messageID int, sender userModels.User) error {
+	message, err := models.Chats.ReadMessageById(messageID, sender.ID)
+	if err != nil {
+		return err
+	}
+
+	chat, err := models.Chats.ReadChatForMember(message.Message.ChatUUID, sender.ID)
+	if err != nil {
+		return err
+	}
+	reciverUUID, memberUUIDs, err := config.ChatAudience(chat, sender.ID)
+	if err != nil {
+		return err
+	}
+
+	var msg config.Message
+	msg.MsgType = msgType
+	msg.Updated = true
+	msg.UserUUID = sender.UUID
+	msg.ReciverUserUUID = reciverUUID
+	msg.ReciverUserUUIDs = memberUUIDs
+	msg.IsGroup = chat.Type == "group"
+	msg.PrivateMessage = message // IsCreatedBy is flipped for the receiver at Broadcast handler
+
+	config.Broadcast <- msg
+	return nil
+}
+
+// writeChatError answers a failed chat operation, unknown chats and chats the
+// user is not a member of look the same
+func writeChatError(w http.ResponseWriter, r *http.Request, logMessage string, err error) {
+	if validation.WriteErrors(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, config.ErrNotChatMember):
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not a member of this chat",
+		})
+	case errors.Is(err, config.ErrUnknownUser):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Unknown user",
+		})
+	case errors.Is(err, config.ErrRateLimited):
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Too many messages",
+		})
+	default:
+		slog.ErrorContext(r.Context(), logMessage, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+	}
+}
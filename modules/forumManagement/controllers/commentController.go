@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
 	"real-time-forum/config"
 	errorManagementControllers "real-time-forum/modules/errorManagement/controllers"
 	"real-time-forum/modules/forumManagement/models"
 	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	userManagementModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
 	"strconv"
 	"strings"
 	"time"
@@ -17,7 +22,7 @@ import (
 
 func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		fmt.Println("Bad method at replying")
+		slog.WarnContext(r.Context(), "Wrong method on replying", "method", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -29,7 +34,7 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the parent type from the query parameter
 	parentType := r.URL.Query().Get("parentType")
 	if parentType == "" {
-		fmt.Println("No parent type at replying")
+		slog.WarnContext(r.Context(), "Missing parent type on replying")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -53,6 +58,7 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 
 		var requestData struct {
 			Content  string `json:"content"`
+			Markdown bool   `json:"markdown"` // opt in to rendering the content as Markdown
 			ParentId int    `json:"parentid"`
 		}
 
@@ -65,8 +71,8 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if requestData.Content == "" || requestData.ParentId == 0 {
-			fmt.Println("Missing content or parent id in comment")
+		if requestData.ParentId == 0 {
+			slog.WarnContext(r.Context(), "Missing parent id on replying")
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]any{
 				"success": false,
@@ -74,11 +80,17 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		if err := validation.Comment(requestData.Content); err != nil {
+			validation.WriteErrors(w, err)
+			return
+		}
 
 		msg.MsgType = "comment"
 		msg.Updated = false
 		msg.IsReplied = true
 		msg.Comment.Description = strings.TrimSpace(requestData.Content)
+		msg.Comment.Format = utils.FormatFor(requestData.Markdown)
+		msg.Comment.RenderDescription()
 
 		parentPost, parentComment := requestData.ParentId, requestData.ParentId
 		if parentType == "post" {
@@ -87,12 +99,29 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 		} else if parentType == "comment" {
 			parentPost = 0
 			msg.Comment.CommentId = requestData.ParentId
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "Unknown parent type",
+			})
+			return
 		}
 		var err error
-		msg.Comment.ID, err = models.InsertComment(parentPost, parentComment, user.ID, msg.Comment.Description)
+		msg.Comment.ID, err = models.Comments.InsertComment(parentPost, parentComment, user.ID, msg.Comment.Description, msg.Comment.Format)
 
+		if errors.Is(err, sql.ErrNoRows) {
+			// Drafts, deleted posts and deleted comments can't be replied to
+			slog.WarnContext(r.Context(), "Reply to a missing parent", "parent_type", parentType, "parent_id", requestData.ParentId)
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "Not found",
+			})
+			return
+		}
 		if err != nil {
-			fmt.Println("Error inserting comment", err.Error())
+			slog.ErrorContext(r.Context(), "Error inserting comment", "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]any{
 				"success": false,
@@ -102,7 +131,7 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if parentType == "post" {
-			msg.NumberOfReplis, err = models.CountCommentsForPost(msg.Comment.PostId)
+			msg.NumberOfReplis, err = models.Comments.CountCommentsForPost(msg.Comment.PostId)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
@@ -112,7 +141,7 @@ func ReplyHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else if parentType == "comment" {
-			msg.NumberOfReplis, err = models.CountCommentsForComment(msg.Comment.CommentId)
+			msg.NumberOfReplis, err = models.Comments.CountCommentsForComment(msg.Comment.CommentId)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
@@ -177,7 +206,7 @@ func GetRepliesHandler(w http.ResponseWriter, r *http.Request) {
 
 	parentID, err := strconv.Atoi(parentIDString)
 	if err != nil {
-		fmt.Println("parentID atoi error:", err.Error())
+		slog.WarnContext(r.Context(), "Invalid parent id", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{"success": false})
 		return
@@ -194,16 +223,44 @@ func GetRepliesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query the database for replies where post_id or comment_id matches parentID
-	var comments []models.Comment
+	// The whole subtree is loaded at once, bounded by depth and by limit replies per comment.
+	// After pages through the direct replies, deeper levels are opened with their own parentID
+	paging := config.Current().Paging
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	if depth <= 0 {
+		depth = paging.ReplyTreeDepth
+	}
+	if depth > paging.MaxReplyTreeDepth {
+		depth = paging.MaxReplyTreeDepth
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = paging.ReplyPageSize
+	}
+	if limit > paging.MaxReplyPageSize {
+		limit = paging.MaxReplyPageSize
+	}
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+	options := models.CommentTreeOptions{MaxDepth: depth, Limit: limit, After: after}
 
-	if parentType == "post" {
-		comments, err = models.ReadAllCommentsForPostByUserID(parentID, user.ID)
-	} else if parentType == "comment" {
-		comments, err = models.ReadAllCommentsForComment(parentID, user.ID)
+	var comments []*models.Comment
+	var moreReplies int
+	switch parentType {
+	case "post":
+		comments, moreReplies, err = models.Comments.ReadCommentSubtree(parentID, 0, user.ID, options)
+	case "comment":
+		comments, moreReplies, err = models.Comments.ReadCommentSubtree(0, parentID, user.ID, options)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Unknown parent type",
+		})
+		return
 	}
 
 	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting replies", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -214,8 +271,9 @@ func GetRepliesHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"success":  true,
-		"comments": comments,
+		"success":     true,
+		"comments":    comments,
+		"moreReplies": moreReplies,
 	})
 }
 
@@ -232,9 +290,9 @@ func ReadAllComments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 	} else {
-		fmt.Println("user is not logged in")
+		slog.DebugContext(r.Context(), "Not logged in")
 	}
 }
 
@@ -250,10 +308,10 @@ func readPostComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 		// return
 	} else {
-		fmt.Println("user is not logged in")
+		slog.DebugContext(r.Context(), "Not logged in")
 	}
 
 	// comments, err := models.ReadCommentsByPostId()
@@ -289,10 +347,10 @@ func createComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 		// return
 	} else {
-		fmt.Println("user is not logged in")
+		slog.DebugContext(r.Context(), "Not logged in")
 	}
 
 	// tmpl, err := template.ParseFiles(
@@ -322,10 +380,10 @@ func SubmitComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 		// return
 	} else {
-		fmt.Println("user is not logged in")
+		slog.DebugContext(r.Context(), "Not logged in")
 	}
 
 	err := r.ParseForm()
@@ -347,13 +405,17 @@ func SubmitComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert a record while checking duplicates
-	_, insertError := models.InsertComment(post_id, 0, loginUser.ID, description) // just 0 to avoid error
+	_, insertError := models.Comments.InsertComment(post_id, 0, loginUser.ID, description, utils.FormatPlain) // just 0 to avoid error
+	if errors.Is(insertError, sql.ErrNoRows) {
+		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.NotFoundError)
+		return
+	}
 	if insertError != nil {
-		fmt.Println(insertError)
+		slog.ErrorContext(r.Context(), "Error inserting comment", "err", insertError)
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
 	} else {
-		fmt.Println("Comment added successfully!")
+		slog.DebugContext(r.Context(), "Comment added")
 	}
 	//userManagementControllers.RedirectToPrevPage(w, r)
 
@@ -370,10 +432,10 @@ func LikeComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 		// return
 	} else {
-		fmt.Println("user is not logged in")
+		slog.DebugContext(r.Context(), "Not logged in")
 	}
 
 	err := r.ParseForm()
@@ -392,19 +454,19 @@ func LikeComment(w http.ResponseWriter, r *http.Request) {
 		Type = dislike
 	}
 
-	existingLikeId, existingLikeType := models.CommentHasLiked(loginUser.ID, commentIDInt)
+	existingLikeId, existingLikeType := models.Likes.CommentHasLiked(loginUser.ID, commentIDInt)
 	if existingLikeId == -1 {
-		models.InsertCommentLike(Type, commentIDInt, loginUser.ID)
+		models.Likes.InsertCommentLike(Type, commentIDInt, loginUser.ID)
 		//userManagementControllers.RedirectToPrevPage(w, r)
 	} else {
-		updateError := models.UpdateCommentLikesStatus(existingLikeId, "delete", loginUser.ID)
+		updateError := models.Likes.UpdateCommentLikesStatus(existingLikeId, "delete", loginUser.ID)
 		if updateError != nil {
 			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 			return
 		}
 
 		if existingLikeType != Type { //this is duplicated like or duplicated dislike so we should update it to disable
-			models.InsertCommentLike(Type, commentIDInt, loginUser.ID)
+			models.Likes.InsertCommentLike(Type, commentIDInt, loginUser.ID)
 
 		}
 		//userManagementControllers.RedirectToPrevPage(w, r)
@@ -412,111 +474,188 @@ func LikeComment(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func UpdateComment(w http.ResponseWriter, r *http.Request) {
+// Edit a comment or reply, only its author or an admin may do it
+func EditReplyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
 		return
 	}
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		fmt.Println("user is not logged in")
+
+	var requestData struct {
+		Content  string `json:"content"`
+		Markdown bool   `json:"markdown"`
 	}
 
-	err := r.ParseForm()
-	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid request",
+		})
 		return
 	}
 
-	idStr := r.FormValue("comment_id")
-	post_uuid := r.FormValue("post_uuid")
-	description := r.FormValue("description")
-
-	if len(idStr) == 0 || len(post_uuid) == 0 || len(description) == 0 {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+	if err := validation.Comment(requestData.Content); err != nil {
+		validation.WriteErrors(w, err)
 		return
 	}
+	description := strings.TrimSpace(requestData.Content)
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	comment, ok := readEditableComment(w, r, user)
+	if !ok {
 		return
 	}
 
-	comment := &models.Comment{
-		ID:          id,
-		Description: description,
-		UserId:      loginUser.ID,
+	comment.Format = utils.FormatFor(requestData.Markdown)
+	err := models.Comments.UpdateComment(&comment, user.ID, description)
+	if err != nil {
+		writeCommentChangeError(w, r, "Error updating comment", err)
+		return
 	}
 
-	// Update a record while checking duplicates
-	updateError := models.UpdateComment(comment, loginUser.ID, description)
-	if updateError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	var msg config.Message
+	msg.MsgType = "commentUpdated"
+	msg.Updated = true
+	msg.Comment, err = models.Comments.ReadCommentById(comment.ID, user.ID)
+	if err != nil {
+		writeCommentChangeError(w, r, "Error reading updated comment", err)
 		return
-	} else {
-		fmt.Println("Comment updated successfully!")
 	}
+	msg.UserUUID = user.UUID
+	config.Broadcast <- msg
 
-	http.Redirect(w, r, "/post/"+post_uuid, http.StatusFound)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
 }
 
-func DeleteComment(w http.ResponseWriter, r *http.Request) {
+// Delete a comment or reply, only its author or an admin may do it.
+// A comment with replies stays in the thread as a "[deleted]" placeholder
+func DeleteReplyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
 		return
 	}
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		fmt.Println("user is not logged in")
+
+	comment, ok := readEditableComment(w, r, user)
+	if !ok {
+		return
 	}
 
-	err := r.ParseForm()
+	err := models.Comments.UpdateCommentStatus(comment.ID, "delete", user.ID)
 	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+		writeCommentChangeError(w, r, "Error deleting comment", err)
 		return
 	}
 
-	idStr := r.FormValue("comment_id")
-	post_uuid := r.FormValue("post_uuid")
+	var msg config.Message
+	msg.MsgType = "commentDeleted"
+	msg.Updated = true
+	msg.Comment = models.Comment{
+		ID:          comment.ID,
+		PostId:      comment.PostId,
+		CommentId:   comment.CommentId,
+		Status:      "delete",
+		Description: models.DeletedCommentText,
+	}
 
-	if len(idStr) == 0 || len(post_uuid) == 0 {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+	// Clients keep the placeholder while it has replies, and update the count of the parent
+	msg.Comment.RepliesCount, err = models.Comments.CountCommentsForComment(comment.ID)
+	if err == nil {
+		if comment.PostId != 0 {
+			msg.NumberOfReplis, err = models.Comments.CountCommentsForPost(comment.PostId)
+		} else {
+			msg.NumberOfReplis, err = models.Comments.CountCommentsForComment(comment.CommentId)
+		}
+	}
+	if err != nil {
+		writeCommentChangeError(w, r, "Error counting replies", err)
 		return
 	}
+	msg.UserUUID = user.UUID
+	config.Broadcast <- msg
 
-	comment_id, err := strconv.Atoi(idStr)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
+}
+
+// readEditableComment reads the comment given by ?commentID= and checks the user may change it.
+// On failure the response is written and ok is false
+func readEditableComment(w http.ResponseWriter, r *http.Request, user userManagementModels.User) (comment models.Comment, ok bool) {
+	commentID, err := strconv.Atoi(r.URL.Query().Get("commentID"))
+	if err != nil || commentID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing comment ID",
+		})
+		return comment, false
+	}
+
+	comment, err = models.Comments.ReadCommentById(commentID, user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		return
+		writeCommentChangeError(w, r, "Error reading comment", err)
+		return comment, false
 	}
 
-	// Update a record while checking duplicates
-	updateError := models.UpdateCommentStatus(comment_id, "delete", loginUser.ID)
-	if updateError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		return
-	} else {
-		fmt.Println("Post delete successfully!")
+	if comment.UserId != user.ID && user.Type != "admin" {
+		slog.WarnContext(r.Context(), "User may not change comment", "comment_id", comment.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not allowed",
+		})
+		return comment, false
 	}
 
-	http.Redirect(w, r, "/post/"+post_uuid, http.StatusFound)
+	return comment, true
+}
+
+func writeCommentChangeError(w http.ResponseWriter, r *http.Request, logMessage string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.DebugContext(r.Context(), logMessage, "err", err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Comment not found",
+		})
+		return
+	}
+	slog.ErrorContext(r.Context(), logMessage, "err", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+	})
 }
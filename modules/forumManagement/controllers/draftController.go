@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"real-time-forum/config"
+	forumModels "real-time-forum/modules/forumManagement/models"
+	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	userManagementModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
+	"strings"
+	"time"
+)
+
+type draftRequest struct {
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Markdown   bool       `json:"markdown"` // opt in to rendering the content as Markdown
+	Categories []int      `json:"categoryIds"`
+	PublishAt  *time.Time `json:"publishAt"` // published automatically then, without it the draft waits to be published by hand
+}
+
+// HandleDrafts serves the drafts of the logged in user. GET lists them, POST saves a new one,
+// PUT ?uuid= saves an edited one and DELETE ?uuid= discards one
+func HandleDrafts(w http.ResponseWriter, r *http.Request) {
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listDrafts(w, r, user)
+	case http.MethodPost:
+		saveDraft(w, r, user, forumModels.Post{})
+	case http.MethodPut:
+		draft, ok := readOwnDraft(w, r, user)
+		if ok {
+			saveDraft(w, r, user, draft)
+		}
+	case http.MethodDelete:
+		discardDraft(w, r, user)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+	}
+}
+
+func listDrafts(w http.ResponseWriter, r *http.Request, user userManagementModels.User) {
+	drafts, err := forumModels.Posts.ReadDraftsByUserID(user.ID)
+	if err != nil {
+		writePostChangeError(w, r, "Error reading drafts", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"drafts":  drafts,
+	})
+}
+
+// saveDraft stores the request as a new draft, or over draft when it has an ID
+func saveDraft(w http.ResponseWriter, r *http.Request, user userManagementModels.User, draft forumModels.Post) {
+	var requestData draftRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid request",
+		})
+		return
+	}
+
+	categories, ok := readCategoryIDs(w, r)
+	if !ok {
+		return
+	}
+
+	// A scheduled draft is published without anyone looking at it, so it has to be complete
+	var err error
+	if requestData.PublishAt != nil {
+		err = validation.ScheduledPost(requestData.Title, requestData.Content, requestData.Categories, categories, *requestData.PublishAt)
+	} else {
+		err = validation.Draft(requestData.Title, requestData.Content, requestData.Categories, categories)
+	}
+	if err != nil {
+		validation.WriteErrors(w, err)
+		return
+	}
+
+	draft.Title = strings.TrimSpace(requestData.Title)
+	draft.Description = strings.TrimSpace(requestData.Content)
+	draft.Format = utils.FormatFor(requestData.Markdown)
+	draft.Status = "draft"
+	draft.PublishAt = requestData.PublishAt
+	draft.User = user
+
+	status := http.StatusOK
+	if draft.ID == 0 {
+		draft.ID, err = forumModels.Posts.InsertPost(&draft, requestData.Categories)
+		status = http.StatusCreated
+	} else {
+		err = forumModels.Posts.UpdateDraft(&draft, requestData.Categories, user.ID)
+	}
+	if err != nil {
+		writePostChangeError(w, r, "Error saving draft", err)
+		return
+	}
+
+	// Read back the stored draft so it has its categories and stored publish time
+	draft, err = forumModels.Posts.ReadDraftByUUID(draft.UUID, user.ID)
+	if err != nil {
+		writePostChangeError(w, r, "Error reading saved draft", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"draft":   draft,
+	})
+}
+
+func discardDraft(w http.ResponseWriter, r *http.Request, user userManagementModels.User) {
+	draft, ok := readOwnDraft(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := forumModels.Posts.UpdateStatusPost(draft.ID, "delete", user.ID); err != nil {
+		writePostChangeError(w, r, "Error deleting draft", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
+}
+
+// PublishDraftHandler publishes the draft ?uuid= right away, POST /api/drafts/publish
+func PublishDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	draft, ok := readOwnDraft(w, r, user)
+	if !ok {
+		return
+	}
+
+	categoryIDs := make([]int, len(draft.Categories))
+	for i, category := range draft.Categories {
+		categoryIDs[i] = category.ID
+	}
+	categories, ok := readCategoryIDs(w, r)
+	if !ok {
+		return
+	}
+	if err := validation.Post(draft.Title, draft.Description, categoryIDs, categories); err != nil {
+		validation.WriteErrors(w, err)
+		return
+	}
+
+	post, err := config.PublishDraft(draft)
+	if err != nil {
+		writePostChangeError(w, r, "Error publishing draft", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"post":    post,
+	})
+}
+
+// readOwnDraft reads the draft given by ?uuid=, users only see their own drafts.
+// On failure the response is written and ok is false
+func readOwnDraft(w http.ResponseWriter, r *http.Request, user userManagementModels.User) (draft forumModels.Post, ok bool) {
+	draftUUID := r.URL.Query().Get("uuid")
+	if draftUUID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing draft",
+		})
+		return draft, false
+	}
+
+	draft, err := forumModels.Posts.ReadDraftByUUID(draftUUID, user.ID)
+	if err != nil {
+		writePostChangeError(w, r, "Error reading draft", err)
+		return draft, false
+	}
+
+	return draft, true
+}
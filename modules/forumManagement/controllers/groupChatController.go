@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"real-time-forum/config"
+	"real-time-forum/modules/forumManagement/models"
+	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/validation"
+	"strings"
+)
+
+func CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	var dataReq struct {
+		Name    string   `json:"name"`
+		Members []string `json:"members"` // user UUIDs, the creator is added automatically
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	name, ok := validGroupName(w, dataReq.Name)
+	if !ok {
+		return
+	}
+
+	memberIDs, ok := resolveGroupMembers(w, r, dataReq.Members, user.ID)
+	if !ok {
+		return
+	}
+	if len(memberIDs) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "A group needs at least one other member",
+		})
+		return
+	}
+
+	chatUUID, err := models.Chats.InsertGroupChat(name, user.ID, memberIDs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating group chat", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	if err := broadcastChatUpdated(chatUUID, user); err != nil {
+		slog.ErrorContext(r.Context(), "Error broadcasting chatUpdated", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":  true,
+		"message":  "Group created",
+		"chatUUID": chatUUID,
+	})
+}
+
+func RenameGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	chat, ok := readGroupForMember(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	var dataReq struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	name, ok := validGroupName(w, dataReq.Name)
+	if !ok {
+		return
+	}
+
+	if err := models.Chats.UpdateChatName(chat.ID, name, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error renaming group chat", "chat", chat.UUID, "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	if err := broadcastChatUpdated(chat.UUID, user); err != nil {
+		slog.ErrorContext(r.Context(), "Error broadcasting chatUpdated", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"message": "Group renamed",
+	})
+}
+
+func AddGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	chat, ok := readGroupForMember(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	var dataReq struct {
+		Members []string `json:"members"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&dataReq); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	memberIDs, ok := resolveGroupMembers(w, r, dataReq.Members, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := models.Chats.InsertChatMembers(chat.ID, memberIDs); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding group chat members", "chat", chat.UUID, "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	if err := broadcastChatUpdated(chat.UUID, user); err != nil {
+		slog.ErrorContext(r.Context(), "Error broadcasting chatUpdated", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"message": "Members added",
+	})
+}
+
+func LeaveGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	chat, ok := readGroupForMember(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	// Read the remaining members first, the user can't look them up after leaving
+	memberUUIDs, err := models.Chats.ReadChatMemberUUIDs(chat.ID, user.ID)
+	if err == nil {
+		err = models.Chats.RemoveChatMember(chat.ID, user.ID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error leaving group chat", "chat", chat.UUID, "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return
+	}
+
+	var msg config.Message
+	msg.MsgType = "chatUpdated"
+	msg.Updated = true
+	msg.IsGroup = true
+	msg.UserUUID = user.UUID
+	msg.ReciverUserUUID = chat.UUID
+	msg.ReciverUserUUIDs = memberUUIDs
+	msg.ReceiverUserName = chat.Name
+	msg.PrivateMessage.Message.ChatUUID = chat.UUID
+
+	config.Broadcast <- msg
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"message": "Left group",
+	})
+}
+
+// readGroupForMember resolves the ChatUUID query parameter to a group chat the user belongs to
+func readGroupForMember(w http.ResponseWriter, r *http.Request, userID int) (models.Chat, bool) {
+	chatUUID := r.URL.Query().Get("ChatUUID")
+	if chatUUID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing chat",
+		})
+		return models.Chat{}, false
+	}
+
+	chat, err := models.Chats.ReadChatForMember(chatUUID, userID)
+	if err == nil && chat.Type != "group" {
+		err = sql.ErrNoRows // Direct chats have a fixed pair of members
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "Group not found",
+			})
+			return models.Chat{}, false
+		}
+		slog.ErrorContext(r.Context(), "Error reading group chat", "chat", chatUUID, "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
+		return models.Chat{}, false
+	}
+
+	return chat, true
+}
+
+// validGroupName trims the name and checks its length
+func validGroupName(w http.ResponseWriter, name string) (string, bool) {
+	if err := validation.GroupName(name); err != nil {
+		validation.WriteErrors(w, err)
+		return "", false
+	}
+
+	return strings.TrimSpace(name), true
+}
+
+// resolveGroupMembers turns member UUIDs into user IDs, skipping the current user and duplicates
+func resolveGroupMembers(w http.ResponseWriter, r *http.Request, memberUUIDs []string, userID int) ([]int, bool) {
+	var memberIDs []int
+	seen := map[int]bool{userID: true}
+
+	for _, memberUUID := range memberUUIDs {
+		memberID, err := userModels.Users.FindUserByUUID(memberUUID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error finding group chat member", "member", memberUUID, "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+			})
+			return nil, false
+		}
+		if memberID <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "Unknown user",
+			})
+			return nil, false
+		}
+		if seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+		memberIDs = append(memberIDs, memberID)
+	}
+
+	return memberIDs, true
+}
+
+// broadcastChatUpdated tells every group member to refresh the chat, e.g. after a rename
+func broadcastChatUpdated(chatUUID string, user userModels.User) error {
+	chat, err := models.Chats.ReadChatForMember(chatUUID, user.ID)
+	if err != nil {
+		return err
+	}
+	reciverUUID, memberUUIDs, err := config.ChatAudience(chat, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var msg config.Message
+	msg.MsgType = "chatUpdated"
+	msg.Updated = true
+	msg.IsGroup = true
+	msg.UserUUID = user.UUID
+	msg.ReciverUserUUID = reciverUUID
+	msg.ReciverUserUUIDs = memberUUIDs
+	msg.ReceiverUserName = chat.Name
+	msg.PrivateMessage.Message.ChatUUID = chat.UUID
+
+	config.Broadcast <- msg
+	return nil
+}
@@ -2,7 +2,7 @@ package controller
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"real-time-forum/config"
 	"real-time-forum/modules/forumManagement/models"
@@ -21,7 +21,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 		return
 	}
 	if r.Method != http.MethodPost {
-		fmt.Println("method:", r.Method)
+		slog.WarnContext(r.Context(), "Wrong method on liking", "method", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -62,7 +62,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 	}
 
 	if postType == "post" {
-		existingLikeId, existingLikeType := models.PostHasLike(user.ID, req.PostID)
+		existingLikeId, existingLikeType := models.Likes.PostHasLike(user.ID, req.PostID)
 
 		if existingLikeId == -1 {
 			post := &models.PostLike{
@@ -70,9 +70,9 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 				PostId: req.PostID,
 				UserId: user.ID,
 			}
-			_, insertError := models.InsertPostLike(post)
+			_, insertError := models.Likes.InsertPostLike(post)
 			if insertError != nil {
-				fmt.Println("Insert like error:", insertError.Error())
+				slog.ErrorContext(r.Context(), "Error inserting post like", "post_id", req.PostID, "err", insertError)
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
 					"success": false,
@@ -81,9 +81,9 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 				return
 			}
 		} else {
-			updateError := models.UpdateStatusPostLike(existingLikeId, "delete", user.ID)
+			updateError := models.Likes.UpdateStatusPostLike(existingLikeId, "delete", user.ID)
 			if updateError != nil {
-				fmt.Println("Update like error:", updateError.Error())
+				slog.ErrorContext(r.Context(), "Error updating post like", "post_id", req.PostID, "err", updateError)
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
 					"success": false,
@@ -98,7 +98,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 					PostId: req.PostID,
 					UserId: user.ID,
 				}
-				_, insertError := models.InsertPostLike(post)
+				_, insertError := models.Likes.InsertPostLike(post)
 				if insertError != nil {
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(map[string]any{
@@ -110,13 +110,12 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 			}
 		}
 	} else if postType == "comment" {
-		existingLikeId, existingLikeType := models.CommentHasLiked(user.ID, req.PostID)
+		existingLikeId, existingLikeType := models.Likes.CommentHasLiked(user.ID, req.PostID)
 
 		if existingLikeId == -1 {
-			insertError := models.InsertCommentLike(opinion, req.PostID, user.ID)
+			insertError := models.Likes.InsertCommentLike(opinion, req.PostID, user.ID)
 			if insertError != nil {
-				fmt.Println(opinion, req.PostID, user.ID)
-				fmt.Println("like comment:", insertError)
+				slog.ErrorContext(r.Context(), "Error inserting comment like", "opinion", opinion, "comment_id", req.PostID, "err", insertError)
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
 					"success": false,
@@ -125,7 +124,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 				return
 			}
 		} else {
-			updateError := models.UpdateCommentLikesStatus(existingLikeId, "delete", user.ID)
+			updateError := models.Likes.UpdateCommentLikesStatus(existingLikeId, "delete", user.ID)
 			if updateError != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(map[string]any{
@@ -136,7 +135,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 			}
 
 			if existingLikeType != opinion { //this is duplicated like or duplicated dislike so we should update it to disable
-				insertError := models.InsertCommentLike(opinion, req.PostID, user.ID)
+				insertError := models.Likes.InsertCommentLike(opinion, req.PostID, user.ID)
 
 				if insertError != nil {
 					w.WriteHeader(http.StatusInternalServerError)
@@ -156,7 +155,7 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 	msg.MsgType = postType
 	msg.UserUUID = user.UUID
 	if postType == "post" {
-		msg.Post, err = models.ReadPostById(req.PostID, user.ID)
+		msg.Post, err = models.Posts.ReadPostById(req.PostID, user.ID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]any{
@@ -166,9 +165,9 @@ func LikeOrDislike(w http.ResponseWriter, r *http.Request, opinion string) {
 			return
 		}
 	} else if postType == "comment" {
-		msg.Comment, err = models.ReadCommentById(req.PostID, user.ID)
+		msg.Comment, err = models.Comments.ReadCommentById(req.PostID, user.ID)
 		if err != nil {
-			fmt.Println("read comment:", err)
+			slog.ErrorContext(r.Context(), "Error reading comment", "comment_id", req.PostID, "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]any{
 				"success": false,
@@ -27,7 +27,7 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	categories, err := models.ReadAllCategories()
+	categories, err := models.Categories.ReadAllCategories()
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
@@ -39,7 +39,7 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := models.ReadAllPosts(loginUser.ID)
+	posts, err := models.Posts.ReadAllPosts(loginUser.ID)
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"real-time-forum/config"
 	errorManagementControllers "real-time-forum/modules/errorManagement/controllers"
@@ -13,6 +13,7 @@ import (
 	userManagementControllers "real-time-forum/modules/userManagement/controllers"
 	userManagementModels "real-time-forum/modules/userManagement/models"
 	"real-time-forum/utils"
+	"real-time-forum/validation"
 	"strconv"
 	"strings"
 	"text/template"
@@ -30,6 +31,14 @@ func HandlePosts(w http.ResponseWriter, r *http.Request) {
 		HandleGetPosts(w, r) // Call function to fetch all posts
 		return
 	}
+	if r.Method == http.MethodPut {
+		UpdatePost(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		DeletePost(w, r)
+		return
+	}
 
 	w.WriteHeader(http.StatusMethodNotAllowed)
 	json.NewEncoder(w).Encode(map[string]any{
@@ -37,7 +46,7 @@ func HandlePosts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Get all posts
+// Get a page of posts, optionally of one category, in the requested sort order
 func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
@@ -52,7 +61,7 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 	// Get category from query
 	categoryIdString := r.URL.Query().Get("categoryid")
 	if categoryIdString == "" {
-		fmt.Println("faulty category id:", categoryIdString)
+		slog.WarnContext(r.Context(), "Missing category id")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -63,7 +72,7 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 
 	catId, err := strconv.Atoi(categoryIdString)
 	if err != nil {
-		fmt.Println("faulty category id:", categoryIdString, catId, err.Error())
+		slog.WarnContext(r.Context(), "Invalid category id", "categoryid", categoryIdString, "err", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -72,15 +81,34 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var posts []forumModels.Post
-	if catId == 0 {
-		posts, err = forumModels.ReadAllPosts(user.ID)
-	} else if catId > 0 {
-		posts, err = forumModels.ReadPostsByCategoryId(user.ID, catId)
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = forumModels.PostSortNewest
+	}
+	if !forumModels.ValidPostSort(sort) {
+		slog.WarnContext(r.Context(), "Unknown sort mode", "sort", sort)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Unknown sort mode",
+		})
+		return
 	}
 
+	// Keyset pagination, before is the ID of the last post already shown
+	before, _ := strconv.Atoi(r.URL.Query().Get("before"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	paging := config.Current().Paging
+	if limit <= 0 {
+		limit = paging.PostPageSize
+	}
+	if limit > paging.MaxPostPageSize {
+		limit = paging.MaxPostPageSize
+	}
+
+	posts, hasMore, err := forumModels.Posts.ReadPostsPage(user.ID, catId, sort, before, limit)
 	if err != nil {
-		fmt.Println("error getting posts:", err.Error())
+		slog.ErrorContext(r.Context(), "Error getting posts", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -92,6 +120,8 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"success": true,
 		"posts":   posts,
+		"sort":    sort,
+		"hasMore": hasMore,
 	})
 }
 
@@ -111,11 +141,12 @@ func HandleNewPost(w http.ResponseWriter, r *http.Request) {
 	var requestData struct {
 		Title      string `json:"title"`
 		Content    string `json:"content"`
+		Markdown   bool   `json:"markdown"` // opt in to rendering the content as Markdown
 		Categories []int  `json:"categoryIds"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		fmt.Println("json parse error:", err.Error())
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -124,19 +155,18 @@ func HandleNewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if requestData.Title == "" || requestData.Content == "" || len(requestData.Categories) == 0 {
-		fmt.Println("Missing title, content or categories in post")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"success": false,
-			"message": "Invalid request",
-		})
+	categories, ok := readCategoryIDs(w, r)
+	if !ok {
+		return
+	}
+	if err := validation.Post(requestData.Title, requestData.Content, requestData.Categories, categories); err != nil {
+		validation.WriteErrors(w, err)
 		return
 	}
 
 	// Trim input
 	title := strings.TrimSpace(requestData.Title)
-	description := strings.TrimSpace(requestData.Content) // Displaying as texcontent prevents execution
+	description := strings.TrimSpace(requestData.Content) // Only shown through its sanitized rendering
 
 	// Create a Post struct
 	msg.MsgType = "post"
@@ -144,16 +174,19 @@ func HandleNewPost(w http.ResponseWriter, r *http.Request) {
 	msg.Post = forumModels.Post{
 		Title:       title,
 		Description: description,
+		Format:      utils.FormatFor(requestData.Markdown),
+		Status:      "enable",
 		CreatedAt:   time.Now(),
 		User:        user,
 	}
+	msg.Post.RenderDescription()
 	msg.UserUUID = user.UUID
 
 	// Store post in DB
 	var err error
-	msg.Post.ID, err = forumModels.InsertPost(&msg.Post, requestData.Categories)
+	msg.Post.ID, err = forumModels.Posts.InsertPost(&msg.Post, requestData.Categories)
 	if err != nil {
-		fmt.Println("error inserting post:", err.Error())
+		slog.ErrorContext(r.Context(), "Error inserting post", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -161,9 +194,9 @@ func HandleNewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg.Post.Categories, err = forumModels.ReadCategoriesByPostId(msg.Post.ID)
+	msg.Post.Categories, err = forumModels.Categories.ReadCategoriesByPostId(msg.Post.ID)
 	if err != nil {
-		fmt.Println("error reading categories:", err.Error())
+		slog.ErrorContext(r.Context(), "Error reading categories", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -183,8 +216,12 @@ func HandleNewPost(w http.ResponseWriter, r *http.Request) {
 }
 
 func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		createCategory(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
-		fmt.Println("Wrong method on getting categories")
+		slog.WarnContext(r.Context(), "Wrong method on getting categories", "method", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -192,9 +229,9 @@ func CategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	categories, err := forumModels.ReadAllCategories()
+	categories, err := forumModels.Categories.ReadAllCategories()
 	if err != nil {
-		fmt.Println("Error reading categories:", err.Error())
+		slog.ErrorContext(r.Context(), "Error reading categories", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -219,69 +256,74 @@ func CategoryHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func FilterPosts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
-		return
-	}
-	searchTerm := r.URL.Query().Get("post_info")
+// createCategory adds the category {"name":...}, only admins may do it
+func createCategory(w http.ResponseWriter, r *http.Request) {
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
-	categories, err := models.ReadAllCategories()
-	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
 
-	posts, err := models.FilterPosts(searchTerm)
-	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if user.Type != "admin" {
+		slog.WarnContext(r.Context(), "User may not create categories")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not allowed",
+		})
 		return
 	}
 
-	data_obj_sender := struct {
-		LoginUser  userManagementModels.User
-		Posts      []models.Post
-		Categories []models.Category
-		SearchTerm string
-	}{
-		LoginUser:  userManagementModels.User{},
-		Posts:      posts,
-		Categories: categories,
-		SearchTerm: searchTerm,
+	var requestData struct {
+		Name string `json:"name"`
 	}
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid request",
+		})
 		return
 	}
-	if loginStatus {
-		data_obj_sender.LoginUser = loginUser
-	}
 
-	// Create a template with a function map
-	tmpl, err := template.New("search_posts.html").Funcs(template.FuncMap{
-		"formatDate": utils.FormatDate, // Register function globally
-	}).ParseFiles(
-		publicUrl+"search_posts.html",
-		publicUrl+"templates/header.html",
-		publicUrl+"templates/navbar.html",
-		publicUrl+"templates/hero.html",
-		publicUrl+"templates/posts.html",
-		publicUrl+"templates/footer.html",
-	)
-	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if err := validation.CategoryName(requestData.Name); err != nil {
+		validation.WriteErrors(w, err)
 		return
 	}
 
-	err = tmpl.Execute(w, data_obj_sender)
+	category := forumModels.Category{
+		Name:      strings.TrimSpace(requestData.Name),
+		CreatedBy: &user.ID,
+	}
+	var err error
+	category.ID, err = forumModels.Categories.InsertCategory(&category)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Category already exists",
+		})
+		return
+	}
 	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		slog.ErrorContext(r.Context(), "Error inserting category", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+		})
 		return
 	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":  true,
+		"category": map[string]any{"id": category.ID, "name": category.Name},
+	})
 }
 
 func ReadMyCreatedPosts(w http.ResponseWriter, r *http.Request) {
@@ -302,19 +344,19 @@ func ReadMyCreatedPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 	} else {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
 		return
 	}
 
-	categories, err := models.ReadAllCategories()
+	categories, err := models.Categories.ReadAllCategories()
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
 	}
 
-	posts, err := models.ReadPostsByUserId(loginUser.ID)
+	posts, err := models.Posts.ReadPostsByUserId(loginUser.ID)
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
@@ -371,19 +413,19 @@ func ReadMyLikedPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 	} else {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
 		return
 	}
 
-	categories, err := models.ReadAllCategories()
+	categories, err := models.Categories.ReadAllCategories()
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
 	}
 
-	posts, err := models.ReadPostsLikedByUserId(loginUser.ID)
+	posts, err := models.Posts.ReadPostsLikedByUserId(loginUser.ID)
 	if err != nil {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 		return
@@ -422,284 +464,230 @@ func ReadMyLikedPosts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Permalink of a post, GET /api/posts/{uuid} returns the post, the user's like state
+// and the nested comment tree
 func ReadPost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
 		return
 	}
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		fmt.Println("user is not logged in")
-	}
 
-	uuid, errUrl := utils.ExtractUUIDFromUrl(r.URL.Path, "post")
-	if errUrl == "not found" {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.NotFoundError)
+	uuid, errUrl := utils.ExtractUUIDFromUrl(r.URL.Path, "api/posts")
+	if errUrl == "not found" || uuid == "" || strings.Contains(uuid, "/") {
+		writePostChangeError(w, r, "Invalid post URL", sql.ErrNoRows)
 		return
 	}
 
-	post, err := models.ReadPostByUUID(uuid, loginUser.ID)
+	post, err := forumModels.Posts.ReadPostByUUID(uuid, user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error reading post", err)
 		return
 	}
 
-	data_obj_sender := struct {
-		LoginUser userManagementModels.User
-		Post      models.Post
-		Comments  []models.Comment
-	}{
-		LoginUser: loginUser,
-		Post:      post,
-		Comments:  nil,
-	}
-
-	if loginStatus {
-		comments, err := models.ReadAllCommentsForPostByUserID(post.ID, loginUser.ID)
-		if err != nil {
-			fmt.Println(err)
-			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-			return
-		}
-
-		data_obj_sender.Comments = comments
-	} else {
-		comments, err := models.ReadAllCommentsForPost(post.ID)
-		if err != nil {
-			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-			return
-		}
-
-		data_obj_sender.Comments = comments
-	}
-
-	// Create a template with a function map
-	tmpl, err := template.New("post_details.html").Funcs(template.FuncMap{
-		"formatDate": utils.FormatDate, // Register function globally
-	}).ParseFiles(
-		publicUrl+"post_details.html",
-		publicUrl+"templates/header.html",
-		publicUrl+"templates/navbar.html",
-		publicUrl+"templates/footer.html",
-	)
+	comments, err := forumModels.Comments.ReadCommentTree(post.ID, user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error reading comments", err)
 		return
 	}
-
-	// Execute template with data
-	err = tmpl.Execute(w, data_obj_sender)
+	// Counted with the same condition as the feed, so the post shows the count it had in the list
+	post.RepliesCount, err = forumModels.Comments.CountCommentsForPost(post.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error counting comments", err)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":  true,
+		"post":     post,
+		"comments": comments,
+	})
 }
 
-func EditPost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
-		return
-	}
+// Edit a post, only its author or an admin may do it
+func UpdatePost(w http.ResponseWriter, r *http.Request) {
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
-		return
+
+	var requestData struct {
+		Title      string `json:"title"`
+		Content    string `json:"content"`
+		Markdown   bool   `json:"markdown"` // opt in to rendering the content as Markdown
+		Categories []int  `json:"categoryIds"`
 	}
 
-	uuid, errUrl := utils.ExtractUUIDFromUrl(r.URL.Path, "editPost")
-	if errUrl == "not found" {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.NotFoundError)
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		slog.WarnContext(r.Context(), "Invalid JSON", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid request",
+		})
 		return
 	}
 
-	post, err := models.ReadPostByUUID(uuid, loginUser.ID)
-	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	categories, ok := readCategoryIDs(w, r)
+	if !ok {
 		return
 	}
-
-	categories, err := models.ReadAllCategories()
-	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+	if err := validation.Post(requestData.Title, requestData.Content, requestData.Categories, categories); err != nil {
+		validation.WriteErrors(w, err)
 		return
 	}
+	title := strings.TrimSpace(requestData.Title)
+	description := strings.TrimSpace(requestData.Content)
 
-	data_obj_sender := struct {
-		LoginUser  userManagementModels.User
-		Post       models.Post
-		Categories []models.Category
-	}{
-		LoginUser:  loginUser,
-		Post:       post,
-		Categories: categories,
+	post, ok := readEditablePost(w, r, user)
+	if !ok {
+		return
 	}
 
-	tmpl, err := template.ParseFiles(
-		publicUrl+"edit_post.html",
-		publicUrl+"templates/header.html",
-		publicUrl+"templates/navbar.html",
-		publicUrl+"templates/footer.html",
-	)
+	post.Title = title
+	post.Description = description
+	post.Format = utils.FormatFor(requestData.Markdown)
+	err := forumModels.Posts.UpdatePost(&post, requestData.Categories, user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error updating post", err)
 		return
 	}
 
-	err = tmpl.Execute(w, data_obj_sender)
+	// Read back the stored post so the feeds get the current categories
+	post, err = forumModels.Posts.ReadPostByUUID(post.UUID, user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error reading updated post", err)
 		return
 	}
-}
 
-func UpdatePost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
-		return
-	}
+	var msg config.Message
+	msg.MsgType = "postUpdated"
+	msg.Updated = true
+	msg.Post = post
+	msg.UserUUID = user.UUID
+	config.Broadcast <- msg
 
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		return
-	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
-		return
-	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"post":    post,
+	})
+}
 
-	err := r.ParseForm()
-	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+// Delete a post, only its author or an admin may do it
+func DeletePost(w http.ResponseWriter, r *http.Request) {
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
 		return
 	}
 
-	idStr := r.FormValue("id")
-	uuid := r.FormValue("uuid")
-	title := r.FormValue("title")
-	description := r.FormValue("description")
-	categories := r.Form["categories"]
-
-	if len(idStr) == 0 || len(title) == 0 || len(description) == 0 || len(categories) == 0 {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
+	post, ok := readEditablePost(w, r, user)
+	if !ok {
 		return
 	}
 
-	id, err := strconv.Atoi(idStr)
+	err := forumModels.Posts.UpdateStatusPost(post.ID, "delete", user.ID)
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
+		writePostChangeError(w, r, "Error deleting post", err)
 		return
 	}
 
-	post := &models.Post{
-		ID:          id,
-		Title:       title,
-		Description: description,
-		UserId:      loginUser.ID,
-	}
-
-	// Convert the string slice to an int slice
-	categoryIds := make([]int, 0, len(categories))
-	for _, category := range categories {
-		if id, err := strconv.Atoi(category); err == nil {
-			categoryIds = append(categoryIds, id)
-		} else {
-			// Handle error if conversion fails (for example, invalid input)
-			http.Error(w, "Invalid category ID", http.StatusBadRequest)
-			return
-		}
-	}
-
-	// Update a record while checking duplicates
-	updateError := models.UpdatePost(post, categoryIds, loginUser.ID)
-	if updateError != nil {
-		if errors.Is(updateError, sql.ErrNoRows) {
-			// todo show toast
-			fmt.Println("Post already exists!")
-		} else {
-			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		}
-		return
-	} else {
-		fmt.Println("Post updated successfully!")
-	}
+	var msg config.Message
+	msg.MsgType = "postDeleted"
+	msg.Updated = true
+	msg.Post = forumModels.Post{ID: post.ID, UUID: post.UUID, Status: "delete"}
+	msg.UserUUID = user.UUID
+	config.Broadcast <- msg
 
-	http.Redirect(w, r, "/post/"+uuid, http.StatusFound)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+	})
 }
 
-func DeletePost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.MethodNotAllowedError)
-		return
-	}
-
-	loginStatus, loginUser, _, checkLoginError := userManagementControllers.ValidateSession(w, r)
-	if checkLoginError != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		return
-	}
-	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
-		// return
-	} else {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
-		return
+// readEditablePost reads the post given by ?uuid= and checks the user may change it.
+// On failure the response is written and ok is false
+func readEditablePost(w http.ResponseWriter, r *http.Request, user userManagementModels.User) (post forumModels.Post, ok bool) {
+	postUUID := r.URL.Query().Get("uuid")
+	if postUUID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing post",
+		})
+		return post, false
 	}
 
-	err := r.ParseForm()
+	post, err := forumModels.Posts.ReadPostByUUID(postUUID, user.ID)
 	if err != nil {
-		fmt.Println(err)
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
-		return
+		writePostChangeError(w, r, "Error reading post", err)
+		return post, false
 	}
 
-	idStr := r.FormValue("id")
-
-	if len(idStr) == 0 {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.BadRequestError)
-		return
+	if post.UserId != user.ID && user.Type != "admin" {
+		slog.WarnContext(r.Context(), "User may not change post", "post", post.UUID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not allowed",
+		})
+		return post, false
 	}
 
-	post_id, err := strconv.Atoi(idStr)
+	return post, true
+}
+
+// readCategoryIDs reads the IDs of the categories posts may use.
+// On failure the response is written and ok is false
+func readCategoryIDs(w http.ResponseWriter, r *http.Request) (categories map[int]bool, ok bool) {
+	categories, err := forumModels.Categories.ReadCategoryIDs()
 	if err != nil {
-		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		return
+		writePostChangeError(w, r, "Error reading categories", err)
+		return nil, false
 	}
+	return categories, true
+}
 
-	// Update a record while checking duplicates
-	updateError := models.UpdateStatusPost(post_id, "delete", loginUser.ID)
-	if updateError != nil {
-		if errors.Is(updateError, sql.ErrNoRows) {
-			// todo show toast
-			fmt.Println("Post already exists!")
-		} else {
-			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
-		}
+func writePostChangeError(w http.ResponseWriter, r *http.Request, logMessage string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.DebugContext(r.Context(), logMessage, "err", err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Post not found",
+		})
 		return
-	} else {
-		fmt.Println("Post delete successfully!")
 	}
-
-	//userManagementControllers.RedirectToIndex(w, r)
+	slog.ErrorContext(r.Context(), logMessage, "err", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+	})
 }
 
 func LikePost(w http.ResponseWriter, r *http.Request) {
@@ -713,7 +701,7 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if loginStatus {
-		fmt.Println("logged in userid is: ", loginUser.ID)
+		slog.DebugContext(r.Context(), "Logged in", "user_id", loginUser.ID)
 	} else {
 		errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.UnauthorizedError)
 		return
@@ -735,7 +723,7 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 		Type = dislike
 	}
 
-	existingLikeId, existingLikeType := models.PostHasLike(loginUser.ID, postIDInt)
+	existingLikeId, existingLikeType := models.Likes.PostHasLike(loginUser.ID, postIDInt)
 
 	if existingLikeId == -1 {
 		post := &models.PostLike{
@@ -743,14 +731,14 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 			PostId: postIDInt,
 			UserId: loginUser.ID,
 		}
-		_, insertError := models.InsertPostLike(post)
+		_, insertError := models.Likes.InsertPostLike(post)
 		if insertError != nil {
 			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 			return
 		}
 		//userManagementControllers.RedirectToPrevPage(w, r)
 	} else {
-		updateError := models.UpdateStatusPostLike(existingLikeId, "delete", loginUser.ID)
+		updateError := models.Likes.UpdateStatusPostLike(existingLikeId, "delete", loginUser.ID)
 		if updateError != nil {
 			errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 			return
@@ -762,7 +750,7 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 				PostId: postIDInt,
 				UserId: loginUser.ID,
 			}
-			_, insertError := models.InsertPostLike(post)
+			_, insertError := models.Likes.InsertPostLike(post)
 			if insertError != nil {
 				errorManagementControllers.HandleErrorPage(w, r, errorManagementControllers.InternalServerError)
 				return
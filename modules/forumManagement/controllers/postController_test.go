@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"real-time-forum/config"
+	"real-time-forum/db"
+	forumModels "real-time-forum/modules/forumManagement/models"
+	userManagementModels "real-time-forum/modules/userManagement/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestForum migrates an in-memory database for the models and logs in a user,
+// returning the cookie of the session. Broadcasts are drained, no hub runs in tests
+func newTestForum(t *testing.T) (userManagementModels.User, *http.Cookie) {
+	t.Helper()
+
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := db.MigrateUp(database); err != nil {
+		t.Fatal(err)
+	}
+	forumModels.Use(database)
+	userManagementModels.Use(database)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		for {
+			select {
+			case <-config.Broadcast:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	user := userManagementModels.User{
+		Username:  "alice",
+		Email:     "alice@example.com",
+		Password:  "not-a-hash",
+		Age:       "30",
+		Gender:    "female",
+		FirstName: "Alice",
+		LastName:  "Smith",
+	}
+	user.ID, err = userManagementModels.Users.InsertUser(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := userManagementModels.Sessions.InsertSession(&userManagementModels.Session{
+		UserId:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, &http.Cookie{Name: "session_token", Value: session.SessionToken}
+}
+
+// serve runs handler on a request with the session cookie and decodes the JSON response
+func serve(t *testing.T, handler http.HandlerFunc, cookie *http.Cookie, method string, url string, body string) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("%s %s: invalid JSON response: %v", method, url, err)
+	}
+	return rec.Code, response
+}
+
+func TestHandleNewPost(t *testing.T) {
+	user, cookie := newTestForum(t)
+
+	code, response := serve(t, HandlePosts, cookie, http.MethodPost, "/api/posts",
+		`{"title":"First post","content":"Hello **forum**","markdown":true,"categoryIds":[1]}`)
+	if code != http.StatusCreated || response["success"] != true {
+		t.Fatalf("creating a post: got %d %v", code, response)
+	}
+
+	posts, _, err := forumModels.Posts.ReadPostsPage(user.ID, 0, forumModels.PostSortNewest, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Title != "First post" || posts[0].UserId != user.ID || posts[0].Format != "markdown" {
+		t.Fatalf("feed after creating a post: got %+v", posts)
+	}
+
+	code, response = serve(t, HandlePosts, cookie, http.MethodPost, "/api/posts",
+		`{"title":"Second post","content":"Hello","categoryIds":[999]}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("creating a post in an unknown category: got %d %v", code, response)
+	}
+}
+
+func TestReplyToDraft(t *testing.T) {
+	user, cookie := newTestForum(t)
+
+	draftID, err := forumModels.Posts.InsertPost(&forumModels.Post{
+		Title:       "Draft",
+		Description: "Not published yet",
+		Format:      "plain",
+		Status:      "draft",
+		User:        user,
+	}, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, response := serve(t, ReplyHandler, cookie, http.MethodPost, "/api/addreply?parentType=post",
+		fmt.Sprintf(`{"content":"First!","parentid":%d}`, draftID))
+	if code != http.StatusNotFound || response["success"] != false {
+		t.Fatalf("replying to a draft: got %d %v", code, response)
+	}
+
+	count, err := forumModels.Comments.CountCommentsForPost(draftID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("replying to a draft stored %d comments", count)
+	}
+}
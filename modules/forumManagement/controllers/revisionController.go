@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"real-time-forum/modules/forumManagement/models"
+	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	"real-time-forum/utils"
+	"strconv"
+)
+
+// RevisionsHandler lists the versions of a post, ?uuid=, or of a comment, ?commentID=,
+// oldest first and the current one last
+func RevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	revisions, ok := readRevisions(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":   true,
+		"revisions": revisions,
+	})
+}
+
+// RevisionDiffHandler compares two versions of a post or comment line by line, chosen by their
+// numbers with ?from= and ?to=. By default the current version is compared with the one before it
+func RevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	revisions, ok := readRevisions(w, r)
+	if !ok {
+		return
+	}
+
+	to, toErr := revisionNumber(r, "to", len(revisions))
+	from, fromErr := revisionNumber(r, "from", to-1)
+	if toErr != nil || fromErr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Invalid revision",
+		})
+		return
+	}
+	if from < 1 || from > len(revisions) || to < 1 || to > len(revisions) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Revision not found",
+		})
+		return
+	}
+
+	older, newer := revisions[from-1], revisions[to-1]
+	response := map[string]any{
+		"success": true,
+		"from":    older,
+		"to":      newer,
+		"lines":   utils.DiffLines(older.Description, newer.Description),
+	}
+	if older.Title != newer.Title {
+		response["title"] = utils.DiffLines(older.Title, newer.Title)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// revisionNumber reads the revision number in the query parameter name, or returns fallback when it's not given
+func revisionNumber(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// readRevisions reads the versions of the post or comment given in the query, anyone logged in may see them.
+// On failure the response is written and ok is false
+func readRevisions(w http.ResponseWriter, r *http.Request) (revisions []models.Revision, ok bool) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return nil, false
+	}
+
+	loginStatus, user, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return nil, false
+	}
+
+	// Deleted posts and comments are not found, their earlier versions stay hidden too
+	if postUUID := r.URL.Query().Get("uuid"); postUUID != "" {
+		post, err := models.Posts.ReadPostByUUID(postUUID, user.ID)
+		if err != nil {
+			writePostChangeError(w, r, "Error reading post", err)
+			return nil, false
+		}
+		revisions, err = models.Revisions.ReadRevisions("post", post.ID)
+		if err != nil {
+			writePostChangeError(w, r, "Error reading revisions", err)
+			return nil, false
+		}
+		return revisions, true
+	}
+
+	commentID, err := strconv.Atoi(r.URL.Query().Get("commentID"))
+	if err != nil || commentID <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Missing post or comment",
+		})
+		return nil, false
+	}
+	comment, err := models.Comments.ReadCommentById(commentID, user.ID)
+	if err != nil {
+		writeCommentChangeError(w, r, "Error reading comment", err)
+		return nil, false
+	}
+	revisions, err = models.Revisions.ReadRevisions("comment", comment.ID)
+	if err != nil {
+		writeCommentChangeError(w, r, "Error reading revisions", err)
+		return nil, false
+	}
+	return revisions, true
+}
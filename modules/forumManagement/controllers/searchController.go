@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"real-time-forum/config"
+	forumModels "real-time-forum/modules/forumManagement/models"
+	userManagementControllers "real-time-forum/modules/userManagement/controllers"
+	"strconv"
+	"time"
+)
+
+// SearchHandler searches posts and comments.
+// Query parameters: q, and optionally categoryid, author (username), from and to (YYYY-MM-DD, inclusive), page and limit
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Method not allowed",
+		})
+		return
+	}
+
+	loginStatus, _, _, validateErr := userManagementControllers.ValidateSession(w, r)
+
+	if !loginStatus || validateErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Not logged in",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	terms := forumModels.SearchTerms(query.Get("q"))
+	if len(terms) == 0 {
+		writeSearchError(w, r, "Missing search terms")
+		return
+	}
+
+	var filter forumModels.SearchFilter
+	var err error
+	if categoryID := query.Get("categoryid"); categoryID != "" {
+		filter.CategoryID, err = strconv.Atoi(categoryID)
+		if err != nil {
+			writeSearchError(w, r, "Invalid category")
+			return
+		}
+	}
+	filter.Author = query.Get("author")
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(time.DateOnly, from)
+		if err != nil {
+			writeSearchError(w, r, "Invalid from date")
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(time.DateOnly, to)
+		if err != nil {
+			writeSearchError(w, r, "Invalid to date")
+			return
+		}
+		filter.To = filter.To.AddDate(0, 0, 1) // include the whole day
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	paging := config.Current().Paging
+	if limit <= 0 {
+		limit = paging.SearchPageSize
+	}
+	if limit > paging.MaxSearchPageSize {
+		limit = paging.MaxSearchPageSize
+	}
+
+	results, hasMore, err := forumModels.SearchIndex.Search(terms, filter, page, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error searching", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": false,
+			"message": "Server error",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"results": results,
+		"page":    page,
+		"hasMore": hasMore,
+	})
+}
+
+func writeSearchError(w http.ResponseWriter, r *http.Request, message string) {
+	slog.DebugContext(r.Context(), "Bad search request", "reason", message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"message": message,
+	})
+}
@@ -2,11 +2,12 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"real-time-forum/db"
 	userManagementModels "real-time-forum/modules/userManagement/models"
 	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 // Category struct represents the user data model
@@ -16,23 +17,21 @@ type Category struct {
 	Status    string                    `json:"status"`
 	CreatedAt time.Time                 `json:"created_at"`
 	UpdatedAt *time.Time                `json:"updated_at"`
-	CreatedBy int                       `json:"created_by"`
+	CreatedBy *int                      `json:"created_by"` // nil for the categories created by migrations
 	UpdatedBy *int                      `json:"updated_by"`
 	User      userManagementModels.User `json:"user"` // Embedded user data
 }
 
-func InsertCategory(category *Category) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CategoryRepository) InsertCategory(category *Category) (int, error) {
+	db := r.db
 
-	insertQuery := `INSERT INTO categories (name) VALUES (?);`
-	result, insertErr := db.Exec(insertQuery, category.Name)
+	insertQuery := `INSERT INTO categories (name, created_by) VALUES (?, ?);`
+	result, insertErr := db.Exec(insertQuery, category.Name, category.CreatedBy)
 	if insertErr != nil {
-		// Check if the error is a SQLite constraint violation
-		if sqliteErr, ok := insertErr.(interface{ ErrorCode() int }); ok {
-			if sqliteErr.ErrorCode() == 19 { // SQLite constraint violation error code
-				return -1, sql.ErrNoRows // Return custom error to indicate a duplicate
-			}
+		// Names are unique, a constraint violation is a duplicate
+		var sqliteErr sqlite3.Error
+		if errors.As(insertErr, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+			return -1, sql.ErrNoRows // Return custom error to indicate a duplicate
 		}
 		return -1, insertErr
 	}
@@ -40,16 +39,14 @@ func InsertCategory(category *Category) (int, error) {
 	// Retrieve the last inserted ID
 	lastInsertID, err := result.LastInsertId()
 	if err != nil {
-		log.Fatal(err)
 		return -1, err
 	}
 
 	return int(lastInsertID), nil
 }
 
-func UpdateCategory(category *Category, userId int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CategoryRepository) UpdateCategory(category *Category, userId int) error {
+	db := r.db
 
 	updateQuery := `UPDATE categories
 					SET name = ?,
@@ -70,9 +67,8 @@ func UpdateCategory(category *Category, userId int) error {
 	return nil
 }
 
-func UpdateStatuCategory(categoryId int, status string, userId int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CategoryRepository) UpdateStatuCategory(categoryId int, status string, userId int) error {
+	db := r.db
 
 	updateQuery := `UPDATE categories
 					SET status = ?,
@@ -93,18 +89,17 @@ func UpdateStatuCategory(categoryId int, status string, userId int) error {
 	return nil
 }
 
-func ReadAllCategories() ([]Category, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CategoryRepository) ReadAllCategories() ([]Category, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
         SELECT c.id as category_id, c.name as category_name, c.status as category_status, 
                c.created_at as category_created_at, c.created_by as category_created_by, 
                c.updated_at as category_updated_at, c.updated_by as category_updated_by,
-               u.id as user_id, u.username as user_username, u.email as user_email
+               COALESCE(u.id, 0) as user_id, COALESCE(u.username, '') as user_username, COALESCE(u.email, '') as user_email
         FROM categories c
-        INNER JOIN users u ON c.created_by = u.id
+        LEFT JOIN users u ON c.created_by = u.id
         WHERE c.status != 'delete';
     `)
 	if selectError != nil {
@@ -143,18 +138,43 @@ func ReadAllCategories() ([]Category, error) {
 	return categories, nil
 }
 
-func ReadCategoryById(categoryId int) (Category, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// ReadCategoryIDs returns the IDs of the enabled categories, the ones posts may use
+func (r *CategoryRepository) ReadCategoryIDs() (map[int]bool, error) {
+	db := r.db
+
+	rows, err := db.Query(`SELECT id FROM categories WHERE status = 'enable';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		ids[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	return ids, nil
+}
+
+func (r *CategoryRepository) ReadCategoryById(categoryId int) (Category, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
         SELECT c.id as category_id, c.name as category_name, c.status as category_status, 
                c.created_at as category_created_at, c.created_by as category_created_by, 
                c.updated_at as category_updated_at, c.updated_by as category_updated_by,
-               u.id as user_id, u.username as user_username, u.email as user_email
+               COALESCE(u.id, 0) as user_id, COALESCE(u.username, '') as user_username, COALESCE(u.email, '') as user_email
         FROM categories c
-        INNER JOIN users u ON c.created_by = u.id  -- Fixed the JOIN to use the correct column for user relation
+        LEFT JOIN users u ON c.created_by = u.id
         WHERE c.status != 'delete'
         AND c.id = ?;
     `, categoryId)
@@ -193,18 +213,17 @@ func ReadCategoryById(categoryId int) (Category, error) {
 	return category, nil
 }
 
-func ReadCategoryByName(categoryName string) (Category, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CategoryRepository) ReadCategoryByName(categoryName string) (Category, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
         SELECT c.id as category_id, c.name as category_name, c.status as category_status, 
                c.created_at as category_created_at, c.created_by as category_created_by, 
                c.updated_at as category_updated_at, c.updated_by as category_updated_by,
-               u.id as user_id, u.username as user_username, u.email as user_email
+               COALESCE(u.id, 0) as user_id, COALESCE(u.username, '') as user_username, COALESCE(u.email, '') as user_email
         FROM categories c
-        INNER JOIN users u ON c.created_by = u.id  -- Fixed the JOIN to use the correct column for user relation
+        LEFT JOIN users u ON c.created_by = u.id
         WHERE c.status != 'delete'
         AND c.name = ?;
     `, categoryName)
@@ -243,9 +262,8 @@ func ReadCategoryByName(categoryName string) (Category, error) {
 	return category, nil
 }
 
-func ReadCategoriesByPostId(postId int) ([]Category, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Ensure the connection is closed
+func (r *CategoryRepository) ReadCategoriesByPostId(postId int) ([]Category, error) {
+	db := r.db
 
 	var categories []Category
 
@@ -254,10 +272,10 @@ func ReadCategoriesByPostId(postId int) ([]Category, error) {
 		SELECT c.id AS category_id, c.name AS category_name, c.status AS category_status, 
 		       c.created_at AS category_created_at, c.created_by AS category_created_by, 
 		       c.updated_at AS category_updated_at, c.updated_by AS category_updated_by,
-		       u.id AS user_id, u.username AS user_username, u.email AS user_email
+		       COALESCE(u.id, 0) AS user_id, COALESCE(u.username, '') AS user_username, COALESCE(u.email, '') AS user_email
 		FROM post_categories pc
 		INNER JOIN categories c ON pc.category_id = c.id AND c.status != 'delete'
-		INNER JOIN users u ON c.created_by = u.id
+		LEFT JOIN users u ON c.created_by = u.id
 		WHERE pc.post_id = ? AND pc.status != 'delete'
 		ORDER BY c.name;
 	`
@@ -2,8 +2,7 @@ package models
 
 import (
 	"database/sql"
-	"fmt"
-	"real-time-forum/db"
+	"log/slog"
 	userModels "real-time-forum/modules/userManagement/models"
 	"real-time-forum/utils"
 	"sort"
@@ -14,8 +13,10 @@ import (
 type Chat struct {
 	ID        int        `json:"id"`
 	UUID      string     `json:"uuid"`
-	User_id_1 int        `json:"user_id_1"`
-	User_id_2 int        `json:"user_id_2"`
+	Type      string     `json:"type"` // direct or group
+	Name      string     `json:"name"` // group chats only
+	User_id_1 *int       `json:"user_id_1"`
+	User_id_2 *int       `json:"user_id_2"`
 	Status    string     `json:"status"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at"`
@@ -29,9 +30,18 @@ type Message struct {
 	UserIDFrom     int        `json:"user_id_from"`
 	SenderUsername string     `json:"sender_username"`
 	Content        string     `json:"content"`
+	Format         string     `json:"format"`       // plain or markdown
+	ContentHTML    string     `json:"content_html"` // sanitized rendering of Content
 	Status         string     `json:"status"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      *time.Time `json:"updated_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+// RenderContent renders the content in its format into ContentHTML
+func (message *Message) RenderContent() {
+	message.ContentHTML = utils.RenderText(message.Content, message.Format)
 }
 
 type PrivateMessage struct {
@@ -39,71 +49,327 @@ type PrivateMessage struct {
 	IsCreatedBy bool    `json:"isCreatedBy"`
 }
 
-func InsertMessage(content string, user_id_from int, chatUUID string) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *ChatRepository) InsertMessage(content string, format string, user_id_from int, chatUUID string) (int, error) {
+	db := r.db
 	tx, err := db.Begin()
 	if err != nil {
-		fmt.Println("db error in InsertMessage", err)
-		return err
+		slog.Error("Error beginning transaction in InsertMessage", "err", err)
+		return -1, err
 	}
 	chatID, updateErr := UpdateChat(chatUUID, user_id_from, tx)
 
 	if updateErr != nil {
-		fmt.Println("update error in InsertMessage", updateErr)
+		slog.Error("Error updating chat in InsertMessage", "chat", chatUUID, "err", updateErr)
 		tx.Rollback()
-		return updateErr
+		return -1, updateErr
 	}
-	insertQuery := `INSERT INTO messages (chat_id, user_id_from, content) VALUES (?, ?, ?);`
-	_, insertErr := tx.Exec(insertQuery, chatID, user_id_from, content)
+	insertQuery := `INSERT INTO messages (chat_id, user_id_from, content, format) VALUES (?, ?, ?, ?);`
+	result, insertErr := tx.Exec(insertQuery, chatID, user_id_from, content, format)
 	if insertErr != nil {
-		fmt.Println("Insert error in InsertMessage", insertErr)
+		slog.Error("Error inserting message", "chat", chatUUID, "err", insertErr)
 		// Check if the error is a SQLite constraint violation
 		tx.Rollback()
 		if sqliteErr, ok := insertErr.(interface{ ErrorCode() int }); ok {
 			if sqliteErr.ErrorCode() == 19 { // SQLite constraint violation error code
-				return sql.ErrNoRows // Return custom error to indicate a duplicate
+				return -1, sql.ErrNoRows // Return custom error to indicate a duplicate
 			}
 		}
-		return insertErr
+		return -1, insertErr
+	}
+
+	// Retrieve the last inserted ID
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return -1, err
 	}
+
 	err = tx.Commit()
 	if err != nil {
-		fmt.Println("Error commiting query at InsertMessage", err)
-		return err
+		slog.Error("Error committing InsertMessage", "chat", chatUUID, "err", err)
+		return -1, err
+	}
+
+	return int(messageID), nil
+}
+
+// MarkMessageDelivered records that a message reached the recipient
+func (r *ChatRepository) MarkMessageDelivered(messageID int) error {
+	db := r.db
+
+	updateQuery := `UPDATE messages
+					SET delivered_at = CURRENT_TIMESTAMP
+					WHERE id = ?
+					AND delivered_at IS NULL;`
+	_, updateErr := db.Exec(updateQuery, messageID)
+	if updateErr != nil {
+		return updateErr
 	}
 
 	return nil
 }
 
-func UpdateMessageStatus(messageID int, status string, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// MarkMessagesDelivered records that a batch of messages reached the recipient
+func (r *ChatRepository) MarkMessagesDelivered(messageIDs []int) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	db := r.db
+
+	placeholders := make([]string, len(messageIDs))
+	values := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		values[i] = id
+	}
+
+	updateQuery := `UPDATE messages
+					SET delivered_at = CURRENT_TIMESTAMP
+					WHERE delivered_at IS NULL
+					AND id IN (` + strings.Join(placeholders, ", ") + `);`
+	_, updateErr := db.Exec(updateQuery, values...)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	return nil
+}
+
+// MarkChatRead marks every message the user received in a chat as read and
+// returns the ID of the newest message that was marked, or 0 if nothing changed
+func (r *ChatRepository) MarkChatRead(chatUUID string, userID int) (int, error) {
+	db := r.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Only members of the chat can mark it read
+	var chatID, lastReadID int
+	err = tx.QueryRow(`
+		SELECT c.id, cm.last_read_message_id
+		FROM chats c
+		INNER JOIN chat_members cm
+			ON cm.chat_id = c.id
+			AND cm.user_id = ?
+			AND cm.status = 'enable'
+		WHERE c.uuid = ?;
+	`, userID, chatUUID).Scan(&chatID, &lastReadID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var newestID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT MAX(id)
+		FROM messages
+		WHERE chat_id = ?
+			AND user_id_from != ?
+			AND id > ?;
+	`, chatID, userID, lastReadID).Scan(&newestID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if !newestID.Valid {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	_, updateErr := tx.Exec(`UPDATE chat_members
+					SET last_read_message_id = ?
+					WHERE chat_id = ?
+					AND user_id = ?;`, newestID.Int64, chatID, userID)
+	if updateErr != nil {
+		tx.Rollback()
+		return 0, updateErr
+	}
+
+	// read_at records the first time a member other than the sender read the message
+	updateQuery := `UPDATE messages
+					SET read_at = CURRENT_TIMESTAMP,
+						delivered_at = COALESCE(delivered_at, CURRENT_TIMESTAMP)
+					WHERE chat_id = ?
+					AND user_id_from != ?
+					AND read_at IS NULL
+					AND id <= ?;`
+	_, updateErr = tx.Exec(updateQuery, chatID, userID, newestID.Int64)
+	if updateErr != nil {
+		tx.Rollback()
+		return 0, updateErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(newestID.Int64), nil
+}
+
+// ReadUndeliveredMessages retrieves direct messages sent to the user that have not reached them yet
+func (r *ChatRepository) ReadUndeliveredMessages(userID int) ([]PrivateMessage, error) {
+	db := r.db
+
+	rows, selectError := db.Query(`
+        SELECT 
+            m.id AS message_id, 
+            m.chat_id,
+			c.uuid, 
+            m.user_id_from, 
+            u.username AS sender_username, 
+            m.content, 
+            m.format,
+            m.status,
+            m.updated_at, 
+            m.created_at
+        FROM messages m
+        INNER JOIN chats c 
+            ON c.id = m.chat_id
+            AND (c.user_id_1 = ? OR c.user_id_2 = ?)
+        INNER JOIN users u 
+            ON m.user_id_from = u.id
+        WHERE m.user_id_from != ?
+            AND m.status != 'delete'
+            AND m.delivered_at IS NULL
+        ORDER BY m.id ASC;
+    `, userID, userID, userID)
+
+	if selectError != nil {
+		slog.Error("Error selecting undelivered messages", "user_id", userID, "err", selectError)
+		return nil, selectError
+	}
+	defer rows.Close()
+
+	var messages []PrivateMessage
+	for rows.Next() {
+		var message PrivateMessage
+
+		err := rows.Scan(&message.Message.ID, &message.Message.ChatID, &message.Message.ChatUUID, &message.Message.UserIDFrom, &message.Message.SenderUsername, &message.Message.Content, &message.Message.Format, &message.Message.Status, &message.Message.UpdatedAt, &message.Message.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		message.Message.RenderContent()
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// UpdateMessageStatus changes the status of a message, only its sender may do so
+func (r *ChatRepository) UpdateMessageStatus(messageID int, status string, user_id int) error {
+	db := r.db
 
 	updateQuery := `UPDATE messages
 					SET status = ?,
-						updated_at = CURRENT_TIMESTAMP,
-					WHERE id = ?;`
-	_, updateErr := db.Exec(updateQuery, status, messageID)
+						updated_at = CURRENT_TIMESTAMP
+					WHERE id = ?
+					AND user_id_from = ?
+					AND status != 'delete';`
+	result, updateErr := db.Exec(updateQuery, status, messageID, user_id)
 	if updateErr != nil {
 		return updateErr
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows // Not the sender's message or already deleted
+	}
+
 	return nil
 }
 
-func InsertChat(user_id_1, user_id_2 int) (string, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// UpdateMessageContent edits the content of a message, only its sender may do so
+func (r *ChatRepository) UpdateMessageContent(messageID int, content string, format string, user_id int) error {
+	db := r.db
+
+	updateQuery := `UPDATE messages
+					SET content = ?,
+						format = ?,
+						updated_at = CURRENT_TIMESTAMP
+					WHERE id = ?
+					AND user_id_from = ?
+					AND status != 'delete';`
+	result, updateErr := db.Exec(updateQuery, content, format, messageID, user_id)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows // Not the sender's message or already deleted
+	}
+
+	return nil
+}
+
+// ReadMessageById retrieves a single message, deleted messages come back as tombstones
+func (r *ChatRepository) ReadMessageById(messageID int, userID int) (PrivateMessage, error) {
+	db := r.db
+
+	var message PrivateMessage
+	err := db.QueryRow(`
+        SELECT 
+            m.id AS message_id, 
+            m.chat_id,
+			c.uuid, 
+            m.user_id_from, 
+            u.username AS sender_username, 
+            CASE WHEN m.status = 'delete' THEN '' ELSE m.content END AS content, 
+            m.format,
+            m.status,
+            m.updated_at, 
+            m.created_at,
+            m.delivered_at,
+            m.read_at
+        FROM messages m
+        INNER JOIN chats c 
+            ON c.id = m.chat_id
+        INNER JOIN users u 
+            ON m.user_id_from = u.id
+        WHERE m.id = ?;
+    `, messageID).Scan(&message.Message.ID, &message.Message.ChatID, &message.Message.ChatUUID, &message.Message.UserIDFrom, &message.Message.SenderUsername, &message.Message.Content, &message.Message.Format, &message.Message.Status, &message.Message.UpdatedAt, &message.Message.CreatedAt, &message.Message.DeliveredAt, &message.Message.ReadAt)
+	if err != nil {
+		return PrivateMessage{}, err
+	}
+	message.Message.RenderContent()
+	if message.Message.UserIDFrom == userID {
+		message.IsCreatedBy = true
+	}
+
+	return message, nil
+}
+
+// InsertChat creates a direct chat between two users along with their memberships
+func (r *ChatRepository) InsertChat(user_id_1, user_id_2 int) (string, error) {
+	db := r.db
 
 	UUID, err := utils.GenerateUuid()
 	if err != nil {
 		return "", err
 	}
 
-	insertQuery := `INSERT INTO chats (uuid, user_id_1, user_id_2) VALUES (?, ?, ?);`
-	_, insertErr := db.Exec(insertQuery, UUID, user_id_1, user_id_2)
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	insertQuery := `INSERT INTO chats (uuid, type, user_id_1, user_id_2, created_by) VALUES (?, 'direct', ?, ?, ?);`
+	result, insertErr := tx.Exec(insertQuery, UUID, user_id_1, user_id_2, user_id_1)
 	if insertErr != nil {
+		tx.Rollback()
 		// Check if the error is a SQLite constraint violation
 		if sqliteErr, ok := insertErr.(interface{ ErrorCode() int }); ok {
 			if sqliteErr.ErrorCode() == 19 { // SQLite constraint violation error code
@@ -113,9 +379,93 @@ func InsertChat(user_id_1, user_id_2 int) (string, error) {
 		return "", insertErr
 	}
 
+	chatID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	for _, userID := range []int{user_id_1, user_id_2} {
+		if err := insertChatMember(int(chatID), userID, tx); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return UUID, nil
+}
+
+// InsertGroupChat creates a named group chat with the creator and the given users as members
+func (r *ChatRepository) InsertGroupChat(name string, creatorID int, memberIDs []int) (string, error) {
+	db := r.db
+
+	UUID, err := utils.GenerateUuid()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	insertQuery := `INSERT INTO chats (uuid, type, name, created_by) VALUES (?, 'group', ?, ?);`
+	result, insertErr := tx.Exec(insertQuery, UUID, name, creatorID)
+	if insertErr != nil {
+		tx.Rollback()
+		return "", insertErr
+	}
+
+	chatID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	for _, userID := range append([]int{creatorID}, memberIDs...) {
+		if err := insertChatMember(int(chatID), userID, tx); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
 	return UUID, nil
 }
 
+// UpdateChatName renames a group chat
+func (r *ChatRepository) UpdateChatName(chatID int, name string, user_id int) error {
+	db := r.db
+
+	updateQuery := `UPDATE chats
+					SET name = ?,
+						updated_at = CURRENT_TIMESTAMP,
+						updated_by = ?
+					WHERE id = ?
+					AND type = 'group';`
+	result, updateErr := db.Exec(updateQuery, name, user_id, chatID)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows // Not a group chat
+	}
+
+	return nil
+}
+
 func UpdateChat(chatUUID string, userID int, tx *sql.Tx) (int, error) {
 	// Perform the update
 	query := `
@@ -126,18 +476,18 @@ func UpdateChat(chatUUID string, userID int, tx *sql.Tx) (int, error) {
 	`
 	result, err := tx.Exec(query, userID, chatUUID)
 	if err != nil {
-		fmt.Println("Error, arguments:", chatUUID, userID)
+		slog.Error("Error updating chat", "chat", chatUUID, "user_id", userID, "err", err)
 		return 0, err
 	}
 
 	// Ensure at least one row was affected
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		fmt.Println("rowsAffected error, arguments:", chatUUID, userID)
+		slog.Error("Error counting updated chats", "chat", chatUUID, "user_id", userID, "err", err)
 		return 0, err
 	}
 	if rowsAffected == 0 {
-		fmt.Println("No rows afffected, arguments:", chatUUID, userID)
+		slog.Debug("No chat updated", "chat", chatUUID, "user_id", userID)
 		return 0, sql.ErrNoRows // No rows were updated, meaning the UUID wasn't found
 	}
 
@@ -145,16 +495,15 @@ func UpdateChat(chatUUID string, userID int, tx *sql.Tx) (int, error) {
 	var chatID int
 	err = tx.QueryRow("SELECT id FROM chats WHERE uuid = ?", chatUUID).Scan(&chatID)
 	if err != nil {
-		fmt.Println("Error getting chat id:", chatUUID, userID, chatID)
+		slog.Error("Error getting chat id", "chat", chatUUID, "user_id", userID, "err", err)
 		return 0, err
 	}
 
 	return chatID, nil
 }
 
-func UpdateChatStatus(chatID int, status string, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *ChatRepository) UpdateChatStatus(chatID int, status string, user_id int) error {
+	db := r.db
 
 	updateQuery := `UPDATE chats
 					SET status = ?,
@@ -176,13 +525,17 @@ type ChatUser struct {
 	LastActivity sql.NullString  `json:"lastActivity"` // Changed to NullString
 	ChatUUID     sql.NullString  `json:"chatUUID"`
 	IsOnline     bool            `json:"isOnline"`
+	Presence     string          `json:"presence"` // online, idle or offline
+	UnreadCount  int             `json:"unreadCount"`
+	IsGroup      bool            `json:"isGroup"`     // Username holds the group name and UserUUID the chat UUID
+	MemberCount  int             `json:"memberCount"` // group chats only
 }
 
-// ReadAllUsers retrieves all usernames: those the user has chatted with and those they haven't
-func ReadAllUsers(userID int) ([]ChatUser, []ChatUser, error) {
+// ReadAllUsers retrieves all usernames: those the user has chatted with and those they haven't.
+// The user's group chats are listed among the chatted users, ordered by last activity
+func (r *ChatRepository) ReadAllUsers(userID int) ([]ChatUser, []ChatUser, error) {
 
-	db := db.OpenDBConnection()
-	defer db.Close()
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
@@ -195,17 +548,20 @@ SELECT u.username,
 	   u.last_time_online,
        c.id AS chat_id,
 	   c.uuid,
-       COALESCE(c.updated_at, c.created_at) AS last_activity
+       COALESCE(c.updated_at, c.created_at) AS last_activity,
+       (SELECT COUNT(*) FROM messages m
+         INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ?
+         WHERE m.chat_id = c.id AND m.user_id_from != ? AND m.id > cm.last_read_message_id AND m.status != 'delete') AS unread_count
 FROM users u
 LEFT JOIN chats c 
   ON (u.id = c.user_id_1 OR u.id = c.user_id_2)
   AND (c.user_id_1 = ? OR c.user_id_2 = ?)
 WHERE u.id != ?
 ORDER BY last_activity DESC;
-    `, userID, userID, userID)
+    `, userID, userID, userID, userID, userID)
 
 	if selectError != nil {
-		fmt.Println("Select error in ReadAllUsers:", selectError)
+		slog.Error("Error selecting users", "user_id", userID, "err", selectError)
 		return nil, nil, selectError
 	}
 	defer rows.Close()
@@ -217,7 +573,7 @@ ORDER BY last_activity DESC;
 	for rows.Next() {
 		var chatID sql.NullInt64
 		var chatUser ChatUser
-		err := rows.Scan(&chatUser.Username, &chatUser.UserUUID, &chatUser.User.Age, &chatUser.User.Gender, &chatUser.User.FirstName, &chatUser.User.LastName, &chatUser.User.LastTimeOnline, &chatID, &chatUser.ChatUUID, &chatUser.LastActivity)
+		err := rows.Scan(&chatUser.Username, &chatUser.UserUUID, &chatUser.User.Age, &chatUser.User.Gender, &chatUser.User.FirstName, &chatUser.User.LastName, &chatUser.User.LastTimeOnline, &chatID, &chatUser.ChatUUID, &chatUser.LastActivity, &chatUser.UnreadCount)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -234,6 +590,17 @@ ORDER BY last_activity DESC;
 		return nil, nil, err
 	}
 
+	groups, err := r.readGroupChats(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) > 0 {
+		chattedUsers = append(chattedUsers, groups...)
+		sort.SliceStable(chattedUsers, func(i, j int) bool {
+			return chattedUsers[i].LastActivity.String > chattedUsers[j].LastActivity.String
+		})
+	}
+
 	// Sort non-chatted users alphabetically
 	sort.Slice(notChattedUsers, func(i, j int) bool {
 		return strings.ToLower(notChattedUsers[i].Username) < strings.ToLower(notChattedUsers[j].Username)
@@ -242,34 +609,79 @@ ORDER BY last_activity DESC;
 	return chattedUsers, notChattedUsers, nil
 }
 
-// findChatByUUID fetches chat ID based on UUID
-func findChatByUUID(UUID string) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
+// readGroupChats lists the group chats the user is a member of in the same shape as chatted users
+func (r *ChatRepository) readGroupChats(userID int) ([]ChatUser, error) {
+	db := r.db
 
-	var chatID int
-	selectQuery := `SELECT id FROM chats WHERE uuid = ?;`
-	err := db.QueryRow(selectQuery, UUID).Scan(&chatID)
-	if err != nil {
-		return 0, err
+	rows, selectError := db.Query(`
+SELECT c.name,
+       c.uuid,
+       COALESCE(c.updated_at, c.created_at) AS last_activity,
+       (SELECT COUNT(*) FROM chat_members members
+         WHERE members.chat_id = c.id AND members.status = 'enable') AS member_count,
+       (SELECT COUNT(*) FROM messages m
+         WHERE m.chat_id = c.id AND m.user_id_from != ? AND m.id > cm.last_read_message_id AND m.status != 'delete') AS unread_count
+FROM chats c
+INNER JOIN chat_members cm
+  ON cm.chat_id = c.id
+  AND cm.user_id = ?
+  AND cm.status = 'enable'
+WHERE c.type = 'group'
+  AND c.status = 'enable';
+    `, userID, userID)
+
+	if selectError != nil {
+		slog.Error("Error selecting group chats", "user_id", userID, "err", selectError)
+		return nil, selectError
 	}
-	return chatID, nil
+	defer rows.Close()
+
+	var groups []ChatUser
+	for rows.Next() {
+		var group ChatUser
+		err := rows.Scan(&group.Username, &group.UserUUID, &group.LastActivity, &group.MemberCount, &group.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		group.IsGroup = true
+		group.ChatUUID = sql.NullString{String: group.UserUUID, Valid: true}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
 }
 
-// ReadAllMessages retrieves the last N messages from a chat
-func ReadAllMessages(chatUUID string, numberOfMessages int, userID int) ([]PrivateMessage, error) {
+// ReadAllMessages retrieves one page of a chat's messages, newest first.
+// With before set it pages back from that message ID, with after set it catches up
+// on messages newer than that ID. The bool reports whether more messages lie beyond the page
+func (r *ChatRepository) ReadAllMessages(chatUUID string, before int, after int, limit int, userID int) ([]PrivateMessage, bool, error) {
 	var lastMessages []PrivateMessage
 
-	chatID, findError := findChatByUUID(chatUUID)
+	// Only members can read a chat
+	chat, findError := r.ReadChatForMember(chatUUID, userID)
 	if findError != nil {
 		if findError.Error() == "sql: no rows in result set" {
-			return lastMessages, nil
+			return lastMessages, false, nil
 		}
-		return nil, findError
+		return nil, false, findError
+	}
+	chatID := chat.ID
+
+	db := r.db
+
+	// One extra row tells whether there is another page
+	cursorCondition := "AND (? = 0 OR m.id < ?)"
+	order := "DESC"
+	cursor := before
+	if after > 0 {
+		cursorCondition = "AND (? = 0 OR m.id > ?)"
+		order = "ASC"
+		cursor = after
 	}
-
-	db := db.OpenDBConnection()
-	defer db.Close()
 
 	// Query messages along with the sender's username
 	rows, selectError := db.Query(`
@@ -279,23 +691,27 @@ func ReadAllMessages(chatUUID string, numberOfMessages int, userID int) ([]Priva
 			c.uuid, 
             m.user_id_from, 
             u.username AS sender_username, 
-            m.content, 
+            CASE WHEN m.status = 'delete' THEN '' ELSE m.content END AS content, 
+            m.format,
             m.status,
             m.updated_at, 
-            m.created_at
+            m.created_at,
+            m.delivered_at,
+            m.read_at
         FROM messages m
         INNER JOIN chats c 
             ON c.id = m.chat_id
         INNER JOIN users u 
             ON m.user_id_from = u.id
         WHERE m.chat_id = ?
-        ORDER BY m.id DESC
+            `+cursorCondition+`
+        ORDER BY m.id `+order+`
         LIMIT ?;
-    `, chatID, numberOfMessages)
+    `, chatID, cursor, cursor, limit+1)
 
 	if selectError != nil {
-		fmt.Println("Select error at ReadAllMessages:", selectError)
-		return nil, selectError
+		slog.Error("Error selecting messages", "chat_id", chatID, "err", selectError)
+		return nil, false, selectError
 	}
 	defer rows.Close()
 
@@ -303,10 +719,11 @@ func ReadAllMessages(chatUUID string, numberOfMessages int, userID int) ([]Priva
 	for rows.Next() {
 		var message PrivateMessage
 
-		err := rows.Scan(&message.Message.ID, &message.Message.ChatID, &message.Message.ChatUUID, &message.Message.UserIDFrom, &message.Message.SenderUsername, &message.Message.Content, &message.Message.Status, &message.Message.UpdatedAt, &message.Message.CreatedAt)
+		err := rows.Scan(&message.Message.ID, &message.Message.ChatID, &message.Message.ChatUUID, &message.Message.UserIDFrom, &message.Message.SenderUsername, &message.Message.Content, &message.Message.Format, &message.Message.Status, &message.Message.UpdatedAt, &message.Message.CreatedAt, &message.Message.DeliveredAt, &message.Message.ReadAt)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
+		message.Message.RenderContent()
 		if message.Message.UserIDFrom == userID {
 			message.IsCreatedBy = true
 		}
@@ -315,25 +732,36 @@ func ReadAllMessages(chatUUID string, numberOfMessages int, userID int) ([]Priva
 
 	// Check for errors after iteration
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	hasMore := len(lastMessages) > limit
+	if hasMore {
+		lastMessages = lastMessages[:limit]
+	}
+
+	// Catch-up pages are read oldest first, return them newest first like the others
+	if after > 0 {
+		sort.Slice(lastMessages, func(i, j int) bool {
+			return lastMessages[i].Message.ID > lastMessages[j].Message.ID
+		})
 	}
 
-	return lastMessages, nil
+	return lastMessages, hasMore, nil
 }
 
-func FindChatUUIDbyUserIDS(userID1, userID2 int) (string, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
+func (r *ChatRepository) FindChatUUIDbyUserIDS(userID1, userID2 int) (string, error) {
+	db := r.db
 
 	var chatUUID string
 
 	err := db.QueryRow(`
 		SELECT uuid 
 		FROM chats 
-		WHERE 
-		    (user_id_1 = ? AND user_id_2 = ?) 
+		WHERE type = 'direct'
+		    AND ((user_id_1 = ? AND user_id_2 = ?) 
 		    OR 
-		    (user_id_2 = ? AND user_id_1 = ?);
+		    (user_id_2 = ? AND user_id_1 = ?));
 	`, userID1, userID2, userID1, userID2).Scan(&chatUUID)
 
 	if err != nil {
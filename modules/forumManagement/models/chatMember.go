@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// insertChatMember adds a user to a chat inside the caller's transaction.
+// Users who left earlier are re-enabled, new messages from then on count as unread
+func insertChatMember(chatID int, userID int, tx *sql.Tx) error {
+	insertQuery := `INSERT INTO chat_members (chat_id, user_id, last_read_message_id)
+					VALUES (?, ?, (SELECT COALESCE(MAX(id), 0) FROM messages WHERE chat_id = ?))
+					ON CONFLICT (chat_id, user_id) DO UPDATE
+					SET status = 'enable',
+						last_read_message_id = excluded.last_read_message_id,
+						updated_at = CURRENT_TIMESTAMP
+					WHERE chat_members.status != 'enable';`
+	_, insertErr := tx.Exec(insertQuery, chatID, userID, chatID)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	return nil
+}
+
+// InsertChatMembers adds users to a group chat
+func (r *ChatRepository) InsertChatMembers(chatID int, userIDs []int) error {
+	db := r.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := insertChatMember(chatID, userID, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveChatMember takes a user out of a chat, the membership row is kept with status delete
+func (r *ChatRepository) RemoveChatMember(chatID int, userID int) error {
+	db := r.db
+
+	updateQuery := `UPDATE chat_members
+					SET status = 'delete',
+						updated_at = CURRENT_TIMESTAMP
+					WHERE chat_id = ?
+					AND user_id = ?
+					AND status = 'enable';`
+	result, updateErr := db.Exec(updateQuery, chatID, userID)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows // Not a member
+	}
+
+	return nil
+}
+
+// ReadChatForMember fetches a chat by UUID if the user is one of its current members,
+// sql.ErrNoRows is returned for unknown chats and non-members alike
+func (r *ChatRepository) ReadChatForMember(chatUUID string, userID int) (Chat, error) {
+	db := r.db
+
+	var chat Chat
+	var name sql.NullString
+	err := db.QueryRow(`
+		SELECT c.id, c.uuid, c.type, c.name, c.user_id_1, c.user_id_2, c.status, c.created_at, c.updated_at, c.updated_by
+		FROM chats c
+		INNER JOIN chat_members cm
+			ON cm.chat_id = c.id
+			AND cm.user_id = ?
+			AND cm.status = 'enable'
+		WHERE c.uuid = ?;
+	`, userID, chatUUID).Scan(&chat.ID, &chat.UUID, &chat.Type, &name, &chat.User_id_1, &chat.User_id_2, &chat.Status, &chat.CreatedAt, &chat.UpdatedAt, &chat.UpdatedBy)
+	if err != nil {
+		return Chat{}, err
+	}
+	chat.Name = name.String
+
+	return chat, nil
+}
+
+// ReadChatMemberUUIDs lists the UUIDs of the chat's current members other than the given user
+func (r *ChatRepository) ReadChatMemberUUIDs(chatID int, userID int) ([]string, error) {
+	db := r.db
+
+	rows, selectError := db.Query(`
+		SELECT u.uuid
+		FROM chat_members cm
+		INNER JOIN users u
+			ON u.id = cm.user_id
+		WHERE cm.chat_id = ?
+			AND cm.user_id != ?
+			AND cm.status = 'enable'
+		ORDER BY cm.id;
+	`, chatID, userID)
+	if selectError != nil {
+		return nil, selectError
+	}
+	defer rows.Close()
+
+	var memberUUIDs []string
+	for rows.Next() {
+		var memberUUID string
+		if err := rows.Scan(&memberUUID); err != nil {
+			return nil, err
+		}
+		memberUUIDs = append(memberUUIDs, memberUUID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberUUIDs, nil
+}
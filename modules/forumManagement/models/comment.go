@@ -3,10 +3,8 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"real-time-forum/db"
 	userManagementModels "real-time-forum/modules/userManagement/models"
-	"sort"
+	"real-time-forum/utils"
 	"time"
 )
 
@@ -25,76 +23,202 @@ type Comment struct {
 	NumberOfLikes    int        `json:"number_of_likes"`
 	NumberOfDislikes int        `json:"number_of_dislikes"`
 	//Post             Post                      `json:"post"`
-	User         userManagementModels.User `json:"user"`
-	RepliesCount int                       `json:"repliesCount"`
+	User            userManagementModels.User `json:"user"`
+	RepliesCount    int                       `json:"repliesCount"`
+	Format          string                    `json:"format"`                // plain or markdown
+	DescriptionHTML string                    `json:"description_html"`      // sanitized rendering of Description
+	Replies         []*Comment                `json:"replies,omitempty"`     // only filled by ReadCommentSubtree
+	MoreReplies     int                       `json:"moreReplies,omitempty"` // replies left out of Replies
+	Revisions       int                       `json:"revisions"`             // earlier versions kept by edits
+	Edited          bool                      `json:"edited"`
 }
 
-func InsertComment(postId int, commentID int, userId int, description string) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// RenderDescription renders the description in its format into DescriptionHTML
+func (comment *Comment) RenderDescription() {
+	comment.DescriptionHTML = utils.RenderText(comment.Description, comment.Format)
+}
+
+// DeletedCommentText replaces the content of a deleted comment that is kept for its replies
+const DeletedCommentText = "[deleted]"
+
+// visibleComment is the SQL condition for comments shown in a thread: live ones, and deleted
+// ones that still have a live reply somewhere below them, so the reply tree stays connected
+func visibleComment(alias string) string {
+	return `(` + alias + `.status != 'delete' OR EXISTS (
+				WITH RECURSIVE descendants(id, status) AS (
+					SELECT r.id, r.status FROM comments r WHERE r.comment_id = ` + alias + `.id
+					UNION ALL
+					SELECT r.id, r.status FROM comments r INNER JOIN descendants d ON r.comment_id = d.id
+				)
+				SELECT 1 FROM descendants WHERE status != 'delete'
+			))`
+}
+
+// openThread starts a query with open_post, the published post of the thread of a post, or of
+// a comment when the post ID is 0. Its parameters are the comment ID and then the post ID, and
+// the comment must also match commentCondition. It's empty for drafts and deleted posts
+func openThread(commentCondition string) string {
+	return `WITH RECURSIVE ancestors(id, post_id, comment_id) AS (
+			SELECT id, post_id, comment_id FROM comments WHERE id = ? AND ` + commentCondition + `
+			UNION ALL
+			SELECT c.id, c.post_id, c.comment_id FROM comments c INNER JOIN ancestors a ON c.id = a.comment_id
+		),
+		open_post(id) AS (
+			SELECT id FROM posts
+			WHERE status = 'enable' AND (id = ? OR id IN (SELECT post_id FROM ancestors))
+		)`
+}
+
+// maskDeletedComment turns a deleted comment into its "[deleted]" placeholder
+func maskDeletedComment(comment *Comment) {
+	if comment.Status != "delete" {
+		return
+	}
+	comment.Description = DeletedCommentText
+	comment.Format = utils.FormatPlain
+	comment.UserId = 0
+	comment.User = userManagementModels.User{}
+	comment.UpdatedAt = nil
+	comment.UpdatedBy = nil // the user who deleted it
+	comment.NumberOfLikes = 0
+	comment.NumberOfDislikes = 0
+	comment.IsLikedByUser = false
+	comment.IsDislikedByUser = false
+	comment.Revisions = 0
+	comment.Edited = false
+}
+
+func (r *CommentRepository) InsertComment(postId int, commentID int, userId int, description string, format string) (int, error) {
+	db := r.db
+
+	// Start a transaction for atomicity
+	tx, err := db.Begin()
+	if err != nil {
+		return -1, err
+	}
+
+	// Only published posts and comments that aren't deleted take replies
+	var open int
+	err = tx.QueryRow(openThread("status != 'delete'")+` SELECT COUNT(*) FROM open_post;`, commentID, postId).Scan(&open)
+	if err != nil {
+		tx.Rollback() // Rollback on error
+		return -1, err
+	}
+	if open == 0 {
+		tx.Rollback() // Rollback on error
+		return -1, sql.ErrNoRows
+	}
 
 	parentId := commentID
 	var insertQuery string
 	if postId == 0 {
-		insertQuery = `INSERT INTO comments  (comment_id ,description, user_id) VALUES ( ?, ?, ?);`
+		insertQuery = `INSERT INTO comments  (comment_id ,description, format, user_id) VALUES ( ?, ?, ?, ?);`
 	} else {
-		insertQuery = `INSERT INTO comments (post_id,description, user_id) VALUES (?, ?, ?);`
+		insertQuery = `INSERT INTO comments (post_id,description, format, user_id) VALUES (?, ?, ?, ?);`
 		parentId = postId
 	}
-	result, insertErr := db.Exec(insertQuery, parentId, description, userId)
+	result, insertErr := tx.Exec(insertQuery, parentId, description, format, userId)
 
 	if insertErr != nil {
+		tx.Rollback() // Rollback on error
 		return -1, insertErr
 	}
 
 	// Retrieve the last inserted ID
 	lastInsertID, errFind := result.LastInsertId()
 	if errFind != nil {
-		log.Println(errFind)
+		tx.Rollback() // Rollback on error
 		return -1, errFind
 	}
 
+	if err := indexItem(tx, "comment", int(lastInsertID), "", description, format); err != nil {
+		tx.Rollback() // Rollback on error
+		return -1, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
 	return int(lastInsertID), nil
 }
 
-func UpdateComment(comment *Comment, user_id int, newDescription string) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) UpdateComment(comment *Comment, user_id int, newDescription string) error {
+	db := r.db
 
 	// Start a transaction for atomicity
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := insertRevision(tx, "comment", comment.ID, "", newDescription, comment.Format); err != nil {
+		tx.Rollback() // Rollback on error
+		return err
+	}
+
 	updateQuery := `UPDATE comments
 					SET description = ?,
+						format = ?,
 						updated_at = CURRENT_TIMESTAMP,
 						updated_by = ?
-					WHERE id = ?;`
-	_, updateErr := db.Exec(updateQuery, newDescription, user_id, comment.ID)
+					WHERE id = ?
+					AND status != 'delete';`
+	result, updateErr := tx.Exec(updateQuery, newDescription, comment.Format, user_id, comment.ID)
 	if updateErr != nil {
+		tx.Rollback() // Rollback on error
 		return updateErr
 	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows // The comment doesn't exist or was deleted
+	}
+
+	if err := indexItem(tx, "comment", comment.ID, "", newDescription, comment.Format); err != nil {
+		tx.Rollback() // Rollback on error
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-func UpdateCommentStatus(id int, status string, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) UpdateCommentStatus(id int, status string, user_id int) error {
+	db := r.db
+
+	// Start a transaction for atomicity
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 
 	updateQuery := `UPDATE comments
 					SET status = ?,
 						updated_at = CURRENT_TIMESTAMP,
 						updated_by = ?
-					WHERE id = ?;`
-	_, updateErr := db.Exec(updateQuery, status, user_id, id)
+					WHERE id = ?
+					AND status != 'delete';`
+	result, updateErr := tx.Exec(updateQuery, status, user_id, id)
 	if updateErr != nil {
+		tx.Rollback() // Rollback on error
 		return updateErr
 	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows // The comment doesn't exist or was deleted
+	}
+
+	// Only enabled comments are searchable
+	if status != "enable" {
+		if err := unindexItem(tx, "comment", id); err != nil {
+			tx.Rollback() // Rollback on error
+			return err
+		}
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-func ReadAllComments() ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) ReadAllComments() ([]Comment, error) {
+	db := r.db
 
 	var comments []Comment
 	selectQuery := `
@@ -106,7 +230,7 @@ func ReadAllComments() ([]Comment, error) {
 			u.id AS user_id, u.uuid AS user_uuid, u.username AS user_username, u.type AS user_type, u.email AS user_email,  
 			u.status AS user_status, u.created_at AS user_created_at, u.updated_at AS user_updated_at, u.updated_by AS user_updated_by
 		FROM comments c
-		INNER JOIN posts p ON c.post_id = p.id AND p.status != 'delete' AND c.status != 'delete'
+		INNER JOIN posts p ON c.post_id = p.id AND p.status NOT IN ('delete', 'draft') AND c.status != 'delete'
 		INNER JOIN users u ON c.user_id = u.id AND u.status != 'delete'
 		ORDER BY c.id asc
 	`
@@ -170,9 +294,8 @@ func ReadAllComments() ([]Comment, error) {
 	return comments, nil
 }
 
-func ReadCommentsFromUserId(userId int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) ReadCommentsFromUserId(userId int) ([]Comment, error) {
+	db := r.db
 
 	var comments []Comment
 
@@ -185,7 +308,7 @@ func ReadCommentsFromUserId(userId int) ([]Comment, error) {
 			c.status AS comment_status, c.created_at AS comment_created_at, c.updated_at AS comment_updated_at, c.updated_by AS comment_updated_by
 		FROM comments c
 		INNER JOIN posts p ON c.post_id = p.i
-		WHERE c.status != 'delete' AND p.status != 'delete' AND c.user_id = ?
+		WHERE c.status != 'delete' AND p.status NOT IN ('delete', 'draft') AND c.user_id = ?
 		ORDER BY c.id asc;
 	`
 
@@ -240,8 +363,7 @@ func ReadCommentsFromUserId(userId int) ([]Comment, error) {
 }
 
 /* func ReadAllCommentsForPost(postId int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+	db := r.db
 
 	var comments []Comment
 	commentMap := make(map[int]*Comment)
@@ -331,9 +453,8 @@ func ReadCommentsFromUserId(userId int) ([]Comment, error) {
 } */
 
 // cgpt version that accounts for comment_id
-func ReadAllCommentsForPost(postId int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) ReadAllCommentsForPost(postId int) ([]Comment, error) {
+	db := r.db
 
 	var comments []Comment
 	commentMap := make(map[int]*Comment)
@@ -425,116 +546,11 @@ func ReadAllCommentsForPost(postId int) ([]Comment, error) {
 	return comments, nil
 }
 
-func ReadAllCommentsForComment(commentId int, userID int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Ensure the connection is closed after the function finishes
-
-	var comments []Comment
-	commentMap := make(map[int]*Comment)
-
-	// Updated query to retrieve replies to a specific comment
-	selectQuery := `
-		SELECT 
-			u.id AS user_id, u.uuid AS user_uuid, u.username AS user_username, u.type AS user_type, u.email AS user_email,  
-			u.status AS user_status, u.created_at AS user_created_at, u.updated_at AS user_updated_at, u.updated_by AS user_updated_by,
-			c.id,c.comment_id AS comment_id, c.post_id as comment_post_id ,c.user_id AS comment_user_id, c.description AS comment_description, 
-			c.status AS comment_status, c.created_at AS comment_created_at, c.updated_at AS comment_updated_at, c.updated_by AS comment_updated_by,
-			(SELECT COUNT(DISTINCT id) from comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like') AS number_of_likes,
-			(SELECT COUNT(DISTINCT id) from comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
-			CASE 
-                WHEN EXISTS (SELECT 1 FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like' AND user_id = ?) THEN 1
-                ELSE 0
-            END AS is_liked_by_user,
-            CASE 
-                WHEN EXISTS (SELECT 1 FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'dislike' AND user_id = ?) THEN 1
-                ELSE 0
-            END AS is_disliked_by_user
-		FROM comments c
-			INNER JOIN users u
-				ON c.user_id = u.id AND c.status != 'delete' AND u.status != 'delete' AND c.comment_id = ?;
-	`
-	rows, selectError := db.Query(selectQuery, userID, userID, commentId) // Query the database
-	if selectError != nil {
-		return nil, selectError
-	}
-	defer rows.Close() // Ensure rows are closed after processing
-
-	// Iterate over rows and populate the slice
-	for rows.Next() {
-		var comment Comment
-		var user userManagementModels.User
-		var postId sql.NullInt64
-		var commentID sql.NullInt64
-		err := rows.Scan(
-			// Map user fields
-			&user.ID,
-			&user.UUID,
-			&user.Username,
-			&user.Type,
-			&user.Email,
-			&user.Status,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.UpdatedBy,
-
-			// Map comment fields
-			&comment.ID,
-			&commentID,
-			&postId, // Parent comment ID
-			&comment.UserId,
-			&comment.Description,
-			&comment.Status,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-			&comment.UpdatedBy,
-			&comment.NumberOfLikes,
-			&comment.NumberOfDislikes,
-			&comment.IsLikedByUser,
-			&comment.IsDislikedByUser,
-		)
-		comment.User = user
-		if err != nil {
-			return nil, err
-		}
-		comment.CommentId = 0
-		comment.PostId = 0
-		if postId.Valid {
-			comment.PostId = int(postId.Int64)
-		} else {
-			comment.CommentId = int(commentID.Int64)
-		}
-		comment.RepliesCount, err = CountCommentsForComment(comment.ID)
-		if err != nil {
-			return nil, err
-		}
-		// Handle likes/dislikes aggregation
-		if _, found := commentMap[comment.ID]; !found {
-			commentMap[comment.ID] = &comment
-		}
-	}
-
-	// Check for any errors during the iteration
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	// Convert the map of comments into a slice
-	for _, comment := range commentMap {
-		comments = append(comments, *comment)
-	}
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].ID < comments[j].ID
-	})
-
-	return comments, nil
-}
-
-func CountCommentsForComment(commentID int) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
+func (r *CommentRepository) CountCommentsForComment(commentID int) (int, error) {
+	db := r.db
 
 	var numberOfComments int
-	err := db.QueryRow("SELECT COUNT(*) FROM comments WHERE comment_id = ?", commentID).Scan(&numberOfComments)
+	err := db.QueryRow("SELECT COUNT(*) FROM comments c WHERE c.comment_id = ? AND "+visibleComment("c"), commentID).Scan(&numberOfComments)
 	if err != nil {
 		return 0, err
 	}
@@ -542,12 +558,11 @@ func CountCommentsForComment(commentID int) (int, error) {
 	return numberOfComments, nil
 }
 
-func CountCommentsForPost(postID int) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
+func (r *CommentRepository) CountCommentsForPost(postID int) (int, error) {
+	db := r.db
 
 	var numberOfComments int
-	err := db.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = ?", postID).Scan(&numberOfComments)
+	err := db.QueryRow("SELECT COUNT(*) FROM comments c WHERE c.post_id = ? AND "+visibleComment("c"), postID).Scan(&numberOfComments)
 	if err != nil {
 		return 0, err
 	}
@@ -555,113 +570,8 @@ func CountCommentsForPost(postID int) (int, error) {
 	return numberOfComments, nil
 }
 
-func ReadAllCommentsForPostByUserID(postId int, userID int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
-
-	var comments []Comment
-	commentMap := make(map[int]*Comment)
-
-	// Updated query to join comments with posts
-	selectQuery := `
-		SELECT 
-			u.id AS user_id, u.uuid AS user_uuid, u.username AS user_username, u.type AS user_type, u.email AS user_email,  
-			u.status AS user_status, u.created_at AS user_created_at, u.updated_at AS user_updated_at, u.updated_by AS user_updated_by,
-			c.id,c.comment_id AS comment_id, c.post_id as comment_post_id ,c.user_id AS comment_user_id, c.description AS comment_description, 
-			c.status AS comment_status, c.created_at AS comment_created_at, c.updated_at AS comment_updated_at, c.updated_by AS comment_updated_by,
-			(SELECT COUNT(DISTINCT id) from comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like') AS number_of_likes,
-			(SELECT COUNT(DISTINCT id) from comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
-			CASE 
-                WHEN EXISTS (SELECT 1 FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like' AND user_id = ?) THEN 1
-                ELSE 0
-            END AS is_liked_by_user,
-            CASE 
-                WHEN EXISTS (SELECT 1 FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'dislike' AND user_id = ?) THEN 1
-                ELSE 0
-            END AS is_disliked_by_user
-		FROM comments c
-			INNER JOIN users u
-				ON c.user_id = u.id AND c.status != 'delete' AND u.status != 'delete' AND c.post_id = ?;
-	`
-	rows, selectError := db.Query(selectQuery, userID, userID, postId) // Query the database
-	if selectError != nil {
-		return nil, selectError
-	}
-
-	defer rows.Close() // Ensure rows are closed after processing
-
-	// Iterate over rows and populate the slice
-	for rows.Next() {
-		var comment Comment
-		var user userManagementModels.User
-		var postID sql.NullInt64
-		var commentID sql.NullInt64
-		err := rows.Scan(
-			// Map post fields
-			&user.ID,
-			&user.UUID,
-			&user.Username,
-			&user.Type,
-			&user.Email,
-			&user.Status,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.UpdatedBy,
-
-			// Map comment fields
-			&comment.ID,
-			&commentID,
-			&postID,
-			&comment.UserId,
-			&comment.Description,
-			&comment.Status,
-			&comment.CreatedAt,
-			&comment.UpdatedAt,
-			&comment.UpdatedBy,
-
-			&comment.NumberOfLikes, &comment.NumberOfDislikes,
-			&comment.IsLikedByUser, &comment.IsDislikedByUser,
-		)
-		comment.User = user
-		if err != nil {
-			return nil, err
-		}
-		comment.CommentId = 0
-		comment.PostId = 0
-		if postID.Valid {
-			comment.PostId = int(postID.Int64)
-		} else {
-			comment.CommentId = int(commentID.Int64)
-		}
-		comment.RepliesCount, err = CountCommentsForComment(comment.ID)
-		if err != nil {
-			return nil, err
-		}
-		_, found := commentMap[comment.ID]
-		if !found {
-			commentMap[comment.ID] = &comment
-		}
-
-	}
-
-	// Check for any errors during the iteration
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	// Convert the map of comments into a slice
-	for _, comment := range commentMap {
-		comments = append(comments, *comment)
-	}
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].ID < comments[j].ID
-	})
-
-	return comments, nil
-}
-
-func ReadAllCommentsOfUserForPost(postId int, userId int) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) ReadAllCommentsOfUserForPost(postId int, userId int) ([]Comment, error) {
+	db := r.db
 
 	var comments []Comment
 	selectQuery := `
@@ -673,7 +583,7 @@ func ReadAllCommentsOfUserForPost(postId int, userId int) ([]Comment, error) {
 			u.id AS user_id, u.uuid AS user_uuid, u.username AS user_username, u.type AS user_type, u.email AS user_email,
 			u.status AS user_status, u.created_at AS user_created_at, u.updated_at AS user_updated_at, u.updated_by AS user_updated_by
 		FROM comments c
-		INNER JOIN posts p ON c.post_id = p.id AND p.status != 'delete' AND c.status != 'delete' AND p.id = ?
+		INNER JOIN posts p ON c.post_id = p.id AND p.status NOT IN ('delete', 'draft') AND c.status != 'delete' AND p.id = ?
 		INNER JOIN users u ON c.user_id = u.id AND u.status != 'delete'
 		where u.id = ?
 		ORDER BY c.id asc;
@@ -737,18 +647,18 @@ func ReadAllCommentsOfUserForPost(postId int, userId int) ([]Comment, error) {
 	return comments, nil
 }
 
-func ReadCommentById(commentId int, checkLikeForUser int) (Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *CommentRepository) ReadCommentById(commentId int, checkLikeForUser int) (Comment, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
-        SELECT c.id, c.post_id, c.comment_id, c.description, c.user_id, c.status, 
+        SELECT c.id, c.post_id, c.comment_id, c.description, c.format, c.user_id, c.status, 
                c.created_at, c.updated_at, c.updated_by,
                (SELECT COUNT(DISTINCT id) FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like') AS number_of_likes,
                (SELECT COUNT(DISTINCT id) FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
                u.id as user_id, u.username, u.email,
                (SELECT COUNT(id) FROM comments WHERE comment_id = c.id AND status != 'delete') AS replies_count,
+               `+revisionCount("comment", "c")+` AS revisions,
                CASE 
                    WHEN EXISTS (SELECT 1 FROM comment_likes WHERE comment_id = c.id AND status != 'delete' AND type = 'like' AND user_id = ?) THEN 1
                    ELSE 0
@@ -773,16 +683,17 @@ func ReadCommentById(commentId int, checkLikeForUser int) (Comment, error) {
 	// Scan the records
 	if rows.Next() {
 		err := rows.Scan(
-			&comment.ID, &postId, &commentID, &comment.Description, &comment.UserId, &comment.Status,
+			&comment.ID, &postId, &commentID, &comment.Description, &comment.Format, &comment.UserId, &comment.Status,
 			&comment.CreatedAt, &comment.UpdatedAt, &comment.UpdatedBy,
 			&comment.NumberOfLikes, &comment.NumberOfDislikes,
 			&user.ID, &user.Username, &user.Email,
-			&comment.RepliesCount,
+			&comment.RepliesCount, &comment.Revisions,
 			&comment.IsLikedByUser, &comment.IsDislikedByUser,
 		)
 		if err != nil {
 			return Comment{}, fmt.Errorf("error scanning row: %v", err)
 		}
+		comment.Edited = comment.Revisions > 0
 		comment.CommentId = 0
 		comment.PostId = 0
 		if postId.Valid {
@@ -792,9 +703,10 @@ func ReadCommentById(commentId int, checkLikeForUser int) (Comment, error) {
 		}
 		// Assign user to comment
 		comment.User = user
+		comment.RenderDescription()
 	} else {
 		// No rows returned, meaning the comment doesn't exist
-		return Comment{}, fmt.Errorf("comment with ID %d not found", commentId)
+		return Comment{}, fmt.Errorf("comment with ID %d not found: %w", commentId, sql.ErrNoRows)
 	}
 
 	// Check for any errors during row iteration
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CommentTreeOptions bound a subtree read, zero values leave it unbounded
+type CommentTreeOptions struct {
+	MaxDepth int // levels read below the parent
+	Limit    int // replies read per comment, and top level comments
+	After    int // top level comments start after this ID, to page through them
+}
+
+// ReadCommentTree reads all visible comments of a post in one query and nests them,
+// each comment carries its replies and their count. Returns the top level comments
+func (r *CommentRepository) ReadCommentTree(postID int, userID int) ([]*Comment, error) {
+	comments, _, err := r.ReadCommentSubtree(postID, 0, userID, CommentTreeOptions{})
+	return comments, err
+}
+
+// ReadCommentSubtree reads the replies of a post, or of a comment when postID is 0, in one query
+// and nests them. Comments whose replies were cut by the depth or the limit tell how many are
+// left in MoreReplies. Returns the top level comments and how many more top level comments there are.
+// Threads of drafts and deleted posts have no replies
+func (r *CommentRepository) ReadCommentSubtree(postID int, commentID int, userID int, options CommentTreeOptions) ([]*Comment, int, error) {
+	db := r.db
+
+	rows, err := db.Query(openThread("1")+`,
+		thread(id, parent_id, depth) AS (
+			SELECT id, 0, 1 FROM comments
+			WHERE (post_id = ? OR comment_id = ?) AND id > ?
+				AND EXISTS (SELECT 1 FROM open_post)
+			UNION ALL
+			SELECT c.id, t.id, t.depth + 1 FROM comments c INNER JOIN thread t ON c.comment_id = t.id
+			WHERE ? = 0 OR t.depth < ?
+		),
+		shown AS (
+			SELECT t.id, t.depth,
+				ROW_NUMBER() OVER (PARTITION BY t.parent_id ORDER BY t.id) AS position,
+				COUNT(*) OVER (PARTITION BY t.parent_id) AS siblings
+			FROM thread t
+				INNER JOIN comments c ON c.id = t.id
+				INNER JOIN users u ON u.id = c.user_id AND u.status != 'delete'
+			WHERE `+visibleComment("c")+`
+		),
+		likes AS (
+			SELECT comment_id,
+				SUM(type = 'like') AS number_of_likes,
+				SUM(type = 'dislike') AS number_of_dislikes,
+				MAX(type = 'like' AND user_id = ?) AS is_liked_by_user,
+				MAX(type = 'dislike' AND user_id = ?) AS is_disliked_by_user
+			FROM comment_likes
+			WHERE status != 'delete'
+				AND comment_id IN (SELECT id FROM shown)
+			GROUP BY comment_id
+		)
+		SELECT c.id, c.post_id, c.comment_id, c.description, c.format, c.user_id, c.status,
+			c.created_at, c.updated_at, c.updated_by,
+			u.uuid, u.username, u.type,
+			COALESCE(l.number_of_likes, 0), COALESCE(l.number_of_dislikes, 0),
+			COALESCE(l.is_liked_by_user, 0), COALESCE(l.is_disliked_by_user, 0),
+			s.depth, s.siblings, `+revisionCount("comment", "c")+`,
+			(SELECT COUNT(*) FROM comments r
+				INNER JOIN users ru ON ru.id = r.user_id AND ru.status != 'delete'
+			WHERE r.comment_id = c.id AND `+visibleComment("r")+`)
+		FROM shown s
+			INNER JOIN comments c ON c.id = s.id
+			INNER JOIN users u ON u.id = c.user_id
+			LEFT JOIN likes l ON l.comment_id = c.id
+		WHERE ? = 0 OR s.position <= ?
+		ORDER BY s.depth, c.id;
+	`, commentID, postID,
+		postID, commentID, options.After,
+		options.MaxDepth, options.MaxDepth,
+		userID, userID,
+		options.Limit, options.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	// Parents come before their replies, so every parent is known when its replies are read
+	var roots []*Comment
+	var rootSiblings int
+	byID := make(map[int]*Comment)
+	for rows.Next() {
+		comment := &Comment{}
+		var parentPostID, parentCommentID sql.NullInt64
+		var depth, siblings int
+		err := rows.Scan(
+			&comment.ID, &parentPostID, &parentCommentID, &comment.Description, &comment.Format,
+			&comment.UserId, &comment.Status, &comment.CreatedAt, &comment.UpdatedAt, &comment.UpdatedBy,
+			&comment.User.UUID, &comment.User.Username, &comment.User.Type,
+			&comment.NumberOfLikes, &comment.NumberOfDislikes,
+			&comment.IsLikedByUser, &comment.IsDislikedByUser,
+			&depth, &siblings, &comment.Revisions, &comment.RepliesCount,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %v", err)
+		}
+		comment.User.ID = comment.UserId
+		comment.PostId = int(parentPostID.Int64)
+		comment.CommentId = int(parentCommentID.Int64)
+		comment.MoreReplies = comment.RepliesCount
+		comment.Edited = comment.Revisions > 0
+		maskDeletedComment(comment)
+		comment.RenderDescription()
+
+		if depth == 1 {
+			roots = append(roots, comment)
+			rootSiblings = siblings
+		} else if parent, found := byID[comment.CommentId]; found {
+			parent.Replies = append(parent.Replies, comment)
+			parent.MoreReplies--
+		} else {
+			continue // the parent was cut by the limit
+		}
+		byID[comment.ID] = comment
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	return roots, rootSiblings - len(roots), nil
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"real-time-forum/db"
 	userManagementModels "real-time-forum/modules/userManagement/models"
 	"time"
 )
@@ -20,9 +19,8 @@ type CommentLike struct {
 	Comment   Comment                   `json:"comment"`
 }
 
-func InsertCommentLike(Type string, commentId int, userId int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) InsertCommentLike(Type string, commentId int, userId int) error {
+	db := r.db
 
 	insertQuery := `INSERT INTO comment_likes (type, user_id, comment_id) VALUES (?, ?, ?);`
 	_, insertErr := db.Exec(insertQuery, Type, userId, commentId)
@@ -33,9 +31,8 @@ func InsertCommentLike(Type string, commentId int, userId int) error {
 	return nil
 }
 
-func UpdateCommentLike(Type string, commentLike CommentLike) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) UpdateCommentLike(Type string, commentLike CommentLike) error {
+	db := r.db
 
 	updateQuery := `UPDATE comment_likes
 	SET type = ?,
@@ -50,9 +47,8 @@ func UpdateCommentLike(Type string, commentLike CommentLike) error {
 	return nil
 }
 
-func UpdateCommentLikesStatus(commentLikeId int, status string, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) UpdateCommentLikesStatus(commentLikeId int, status string, user_id int) error {
+	db := r.db
 
 	updateQuery := `UPDATE comment_likes
 	SET status = ?,
@@ -67,9 +63,8 @@ func UpdateCommentLikesStatus(commentLikeId int, status string, user_id int) err
 	return nil
 }
 
-func ReadAllCommentsLikedByUserId(userId int, Type string) ([]Comment, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) ReadAllCommentsLikedByUserId(userId int, Type string) ([]Comment, error) {
+	db := r.db
 
 	selectQuery := `SELECT 
 			p.id AS post_id, p.uuid AS post_uuid, p.title AS post_title, p.description AS post_description, 
@@ -83,7 +78,7 @@ func ReadAllCommentsLikedByUserId(userId int, Type string) ([]Comment, error) {
 			INNER JOIN comments c
 				ON cl.comment_id = c.id AND cl.user_id = ? AND cl.type = ? c.status != 'delete' AND cl.status != 'delete' 
 			INNER JOIN posts p 
-				ON c.post_id = p.id AND p.status != 'delete' 
+				ON c.post_id = p.id AND p.status NOT IN ('delete', 'draft') 
 			INNER JOIN users u 
 				ON cl.user_id = u.id AND u.status != 'delete;'		
 	`
@@ -147,9 +142,8 @@ func ReadAllCommentsLikedByUserId(userId int, Type string) ([]Comment, error) {
 
 }
 
-func CommentHasLiked(userId int, commentID int) (int, string) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) CommentHasLiked(userId int, commentID int) (int, string) {
+	db := r.db
 	var existingLikeId int
 	var existingLikeType string
 	likeCheckQuery := `SELECT id, type
@@ -3,13 +3,10 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"real-time-forum/db"
+	"log/slog"
 	userManagementModels "real-time-forum/modules/userManagement/models"
 	"real-time-forum/utils"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -31,11 +28,20 @@ type Post struct {
 	User             userManagementModels.User `json:"user"`       // Embedded user data
 	Categories       []Category                `json:"categories"` // List of categories related to the post
 	RepliesCount     int                       `json:"repliesCount"`
+	Format           string                    `json:"format"`           // plain or markdown
+	DescriptionHTML  string                    `json:"description_html"` // sanitized rendering of Description
+	PublishAt        *time.Time                `json:"publish_at"`       // when a scheduled draft gets published
+	Revisions        int                       `json:"revisions"`        // earlier versions kept by edits
+	Edited           bool                      `json:"edited"`
 }
 
-func InsertPost(post *Post, categoryIds []int) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// RenderDescription renders the description in its format into DescriptionHTML
+func (post *Post) RenderDescription() {
+	post.DescriptionHTML = utils.RenderText(post.Description, post.Format)
+}
+
+func (r *PostRepository) InsertPost(post *Post, categoryIds []int) (int, error) {
+	db := r.db
 
 	// Start a transaction for atomicity
 	tx, err := db.Begin()
@@ -49,8 +55,8 @@ func InsertPost(post *Post, categoryIds []int) (int, error) {
 		return -1, err
 	}
 
-	insertQuery := `INSERT INTO posts (uuid, title, description, user_id) VALUES (?, ?, ?, ?);`
-	result, insertErr := tx.Exec(insertQuery, post.UUID, post.Title, post.Description, post.User.ID)
+	insertQuery := `INSERT INTO posts (uuid, title, description, format, status, publish_at, user_id) VALUES (?, ?, ?, ?, ?, ?, ?);`
+	result, insertErr := tx.Exec(insertQuery, post.UUID, post.Title, post.Description, post.Format, post.Status, sqlTime(post.PublishAt), post.User.ID)
 	if insertErr != nil {
 		tx.Rollback() // Rollback on error
 		// Check if the error is a SQLite constraint violation
@@ -66,17 +72,24 @@ func InsertPost(post *Post, categoryIds []int) (int, error) {
 	lastInsertID, err := result.LastInsertId()
 	if err != nil {
 		tx.Rollback() // Rollback on error
-		log.Println(err)
 		return -1, err
 	}
 
 	insertPostCategoriesErr := InsertPostCategories(int(lastInsertID), categoryIds, post.User.ID, tx)
 	if insertPostCategoriesErr != nil {
-		fmt.Println("err insert cats:", insertPostCategoriesErr)
+		slog.Error("Error inserting post categories", "err", insertPostCategoriesErr)
 		tx.Rollback() // Rollback on error
 		return -1, insertPostCategoriesErr
 	}
 
+	// Drafts are indexed when they get published
+	if post.Status == "enable" {
+		if err := indexItem(tx, "post", int(lastInsertID), post.Title, post.Description, post.Format); err != nil {
+			tx.Rollback() // Rollback on error
+			return -1, err
+		}
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		tx.Rollback() // Rollback on error
@@ -86,9 +99,8 @@ func InsertPost(post *Post, categoryIds []int) (int, error) {
 	return int(lastInsertID), nil
 }
 
-func UpdatePost(post *Post, categories []int, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) UpdatePost(post *Post, categories []int, user_id int) error {
+	db := r.db
 
 	// Start a transaction for atomicity
 	tx, err := db.Begin()
@@ -96,13 +108,20 @@ func UpdatePost(post *Post, categories []int, user_id int) error {
 		return err
 	}
 
+	if err := insertRevision(tx, "post", post.ID, post.Title, post.Description, post.Format); err != nil {
+		tx.Rollback() // Rollback on error
+		return err
+	}
+
 	updateQuery := `UPDATE posts
 					SET title = ?,
 						description = ?,
+						format = ?,
 						updated_at = CURRENT_TIMESTAMP,
 						updated_by = ?
-					WHERE id = ?;`
-	_, updateErr := tx.Exec(updateQuery, post.Title, post.Description, user_id, post.ID)
+					WHERE id = ?
+					AND status != 'delete';`
+	result, updateErr := tx.Exec(updateQuery, post.Title, post.Description, post.Format, user_id, post.ID)
 	if updateErr != nil {
 		tx.Rollback() // Rollback on error
 		// Check if the error is a SQLite constraint violation
@@ -113,6 +132,10 @@ func UpdatePost(post *Post, categories []int, user_id int) error {
 		}
 		return updateErr
 	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows // The post doesn't exist or was deleted
+	}
 
 	deletePostCategoriesErr := UpdateStatusPostCategories(post.ID, user_id, "delete", tx)
 	if deletePostCategoriesErr != nil {
@@ -126,6 +149,11 @@ func UpdatePost(post *Post, categories []int, user_id int) error {
 		return insertPostCategoriesErr
 	}
 
+	if err := indexItem(tx, "post", post.ID, post.Title, post.Description, post.Format); err != nil {
+		tx.Rollback() // Rollback on error
+		return err
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		tx.Rollback() // Rollback on error
@@ -135,9 +163,8 @@ func UpdatePost(post *Post, categories []int, user_id int) error {
 	return nil
 }
 
-func UpdateStatusPost(post_id int, status string, user_id int) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) UpdateStatusPost(post_id int, status string, user_id int) error {
+	db := r.db
 
 	// Start a transaction for atomicity
 	tx, err := db.Begin()
@@ -149,8 +176,9 @@ func UpdateStatusPost(post_id int, status string, user_id int) error {
 					SET status = ?,
 						updated_at = CURRENT_TIMESTAMP,
 						updated_by = ?
-					WHERE id = ?;`
-	_, updateErr := tx.Exec(updateQuery, status, user_id, post_id)
+					WHERE id = ?
+					AND status != 'delete';`
+	result, updateErr := tx.Exec(updateQuery, status, user_id, post_id)
 	if updateErr != nil {
 		tx.Rollback() // Rollback on error
 		// Check if the error is a SQLite constraint violation
@@ -161,6 +189,10 @@ func UpdateStatusPost(post_id int, status string, user_id int) error {
 		}
 		return updateErr
 	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows // The post doesn't exist or was deleted
+	}
 
 	updateStatusPostCategories := UpdateStatusPostCategories(post_id, user_id, status, tx)
 	if updateStatusPostCategories != nil {
@@ -168,6 +200,14 @@ func UpdateStatusPost(post_id int, status string, user_id int) error {
 		return updateStatusPostCategories
 	}
 
+	// Only enabled posts are searchable
+	if status != "enable" {
+		if err := unindexItem(tx, "post", post_id); err != nil {
+			tx.Rollback() // Rollback on error
+			return err
+		}
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		tx.Rollback() // Rollback on error
@@ -177,9 +217,8 @@ func UpdateStatusPost(post_id int, status string, user_id int) error {
 	return nil
 }
 
-func ReadAllPosts(userId int) ([]Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadAllPosts(userId int) ([]Post, error) {
+	db := r.db
 
 	// Query the records
 	/* 	rows, selectError := db.Query(`
@@ -195,7 +234,7 @@ func ReadAllPosts(userId int) ([]Post, error) {
 				LEFT JOIN categories c
 					ON pc.category_id = c.id
 					AND c.status = 'enable'
-			WHERE p.status != 'delete'
+			WHERE p.status NOT IN ('delete', 'draft')
 				AND u.status != 'delete'
 			ORDER BY p.id desc;
 	    `) */
@@ -207,6 +246,7 @@ func ReadAllPosts(userId int) ([]Post, error) {
     p.uuid as post_uuid, 
     p.title as post_title, 
     p.description as post_description, 
+    p.format as post_format, 
     p.status as post_status, 
     p.created_at as post_created_at, 
     p.updated_at as post_updated_at, 
@@ -218,8 +258,9 @@ func ReadAllPosts(userId int) ([]Post, error) {
      FROM post_likes 
      WHERE post_id = p.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
     (SELECT COUNT(*) 
-     FROM comments 
-     WHERE post_id = p.id
+     FROM comments cm
+     WHERE cm.post_id = p.id
+     AND `+visibleComment("cm")+`
     ) AS number_of_comments,
     u.id as user_id, 
     u.username as user_username, 
@@ -238,7 +279,7 @@ FROM posts p
 INNER JOIN users u ON p.user_id = u.id
 LEFT JOIN post_categories pc ON p.id = pc.post_id AND pc.status = 'enable'
 LEFT JOIN categories c ON pc.category_id = c.id AND c.status = 'enable'
-WHERE p.status != 'delete' AND u.status != 'delete';
+WHERE p.status NOT IN ('delete', 'draft') AND u.status != 'delete';
 
     `, userId, userId)
 
@@ -258,7 +299,7 @@ WHERE p.status != 'delete' AND u.status != 'delete';
 
 		// Scan the post and user data
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
 			&post.NumberOfLikes, &post.NumberOfDislikes, &post.RepliesCount,
 			&post.UserId, &user.Username, &user.Email,
@@ -288,6 +329,7 @@ WHERE p.status != 'delete' AND u.status != 'delete';
 
 	// Convert the map of posts into a slice
 	for _, post := range postMap {
+		post.RenderDescription()
 		posts = append(posts, *post)
 	}
 
@@ -298,194 +340,12 @@ WHERE p.status != 'delete' AND u.status != 'delete';
 	return posts, nil
 }
 
-func ReadPostsByCategoryId(userID int, categoryID int) ([]Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close()
-
-	rows, selectError := db.Query(`
-	SELECT 
-		p.id AS post_id, p.uuid AS post_uuid, p.title AS post_title, 
-		p.description AS post_description, p.status AS post_status, 
-		p.created_at AS post_created_at, p.updated_at AS post_updated_at, 
-		p.updated_by AS post_updated_by,
-		
-		(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like') AS number_of_likes,
-		(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
-	
-		u.id AS user_id, u.username AS user_username, u.email AS user_email,
-	
-		GROUP_CONCAT(DISTINCT c.id) AS category_ids,
-		GROUP_CONCAT(DISTINCT c.name) AS category_names,
-	
-		CASE 
-			WHEN EXISTS (SELECT 1 FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like' AND user_id = ?) THEN 1
-			ELSE 0
-		END AS is_liked_by_user,
-		CASE 
-			WHEN EXISTS (SELECT 1 FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike' AND user_id = ?) THEN 1
-			ELSE 0
-		END AS is_disliked_by_user,
-	
-		(SELECT COUNT(*) FROM comments WHERE post_id = p.id) AS number_of_comments
-	
-	FROM posts p
-	INNER JOIN users u ON p.user_id = u.id
-	LEFT JOIN post_categories pc 
-		ON p.id = pc.post_id 
-		AND pc.status = 'enable'
-	LEFT JOIN categories c 
-		ON pc.category_id = c.id 
-		AND c.status = 'enable'
-	WHERE p.status != 'delete' 
-		AND u.status != 'delete'
-		AND p.id IN (
-			SELECT post_id FROM post_categories WHERE category_id = ? AND status = 'enable'
-		)
-	GROUP BY p.id, u.id;
-	`, userID, userID, categoryID)
-
-	if selectError != nil {
-		return nil, selectError
-	}
-	defer rows.Close()
-
-	var posts []Post
-	postMap := make(map[int]*Post)
-
-	for rows.Next() {
-		var post Post
-		var user userManagementModels.User
-		var categoryIDs string
-		var categoryNames string
-
-		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
-			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
-			&post.NumberOfLikes, &post.NumberOfDislikes,
-			&post.UserId, &user.Username, &user.Email,
-			&categoryIDs, &categoryNames,
-			&post.IsLikedByUser, &post.IsDislikedByUser, &post.RepliesCount,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %v", err)
-		}
-
-		// Convert category strings into slices
-		categoryIDList := strings.Split(categoryIDs, ",")
-		categoryNameList := strings.Split(categoryNames, ",")
-
-		var categories []Category
-		for i := range categoryIDList {
-			id, _ := strconv.Atoi(categoryIDList[i])
-			categories = append(categories, Category{ID: id, Name: categoryNameList[i]})
-		}
-
-		post.User = user
-		post.Categories = categories
-		posts = append(posts, post)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
-	}
-
-	for _, post := range postMap {
-		posts = append(posts, *post)
-	}
-
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].ID < posts[j].ID
-	})
-
-	return posts, nil
-}
-
-func FilterPosts(searchTerm string) ([]Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
-
-	searchPattern := "%" + searchTerm + "%" // Add wildcards for LIKE comparison
-
-	// Query the records
-	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
-			u.id as user_id, u.username as user_username, u.email as user_email,
-			c.id as category_id, c.name as category_name
-		FROM posts p
-			INNER JOIN users u
-				ON p.user_id = u.id
-			LEFT JOIN post_categories pc
-				ON p.id = pc.post_id
-				AND pc.status = 'enable'
-			LEFT JOIN categories c
-				ON pc.category_id = c.id
-				AND c.status = 'enable'
-		WHERE p.status != 'delete'
-			AND u.status != 'delete'
-      		AND (p.title LIKE ? OR p.description LIKE ?)
-		ORDER BY p.id asc;
-    `, searchPattern, searchPattern)
-	if selectError != nil {
-		return nil, selectError
-	}
-	defer rows.Close()
-
-	var posts []Post
-	// Map to track posts by their ID to avoid duplicates
-	postMap := make(map[int]*Post)
-
-	for rows.Next() {
-		var post Post
-		var user userManagementModels.User
-		var category Category
-
-		// Scan the post and user data
-		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
-			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &post.UserId,
-			&user.Username, &user.Email,
-			&category.ID, &category.Name,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %v", err)
-		}
-
-		// Check if the post already exists in the postMap
-		if existingPost, found := postMap[post.ID]; found {
-			// If the post exists, append the category to the existing post's Categories
-			existingPost.Categories = append(existingPost.Categories, category)
-		} else {
-			// If the post doesn't exist in the map, add it and initialize the Categories field
-			post.User = user
-			post.Categories = []Category{category}
-			postMap[post.ID] = &post
-		}
-	}
-
-	// Check for any errors during row iteration
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
-	}
-
-	// Convert the map of posts into a slice
-	for _, post := range postMap {
-		posts = append(posts, *post)
-	}
-
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].ID > posts[j].ID
-	})
-
-	return posts, nil
-}
-
-func ReadPostsByUserId(userId int) ([]Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadPostsByUserId(userId int) ([]Post, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
+        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.format as post_format, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
 			u.id as user_id, u.username as user_username, u.email as user_email,
 			c.id as category_id, c.name as category_name
 		FROM posts p
@@ -498,7 +358,7 @@ func ReadPostsByUserId(userId int) ([]Post, error) {
 			LEFT JOIN categories c
 				ON pc.category_id = c.id
 				AND c.status = 'enable'
-		WHERE p.status != 'delete'
+		WHERE p.status NOT IN ('delete', 'draft')
 			AND u.status != 'delete'
 		ORDER BY p.id asc;
     `, userId)
@@ -518,7 +378,7 @@ func ReadPostsByUserId(userId int) ([]Post, error) {
 
 		// Scan the post and user data
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &post.UserId,
 			&user.Username, &user.Email,
 			&category.ID, &category.Name,
@@ -546,6 +406,7 @@ func ReadPostsByUserId(userId int) ([]Post, error) {
 
 	// Convert the map of posts into a slice
 	for _, post := range postMap {
+		post.RenderDescription()
 		posts = append(posts, *post)
 	}
 
@@ -556,13 +417,12 @@ func ReadPostsByUserId(userId int) ([]Post, error) {
 	return posts, nil
 }
 
-func ReadPostsLikedByUserId(userId int) ([]Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadPostsLikedByUserId(userId int) ([]Post, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
+        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.format as post_format, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
 			u.id as user_id, u.username as user_username, u.email as user_email,
 			c.id as category_id, c.name as category_name
 		FROM posts p
@@ -580,7 +440,7 @@ func ReadPostsLikedByUserId(userId int) ([]Post, error) {
 			LEFT JOIN categories c
 				ON pc.category_id = c.id
 				AND c.status = 'enable'
-		WHERE p.status != 'delete'
+		WHERE p.status NOT IN ('delete', 'draft')
 			AND u.status != 'delete'
 		ORDER BY p.id asc;
     `, userId)
@@ -600,7 +460,7 @@ func ReadPostsLikedByUserId(userId int) ([]Post, error) {
 
 		// Scan the post and user data
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &post.UserId,
 			&user.Username, &user.Email,
 			&category.ID, &category.Name,
@@ -628,6 +488,7 @@ func ReadPostsLikedByUserId(userId int) ([]Post, error) {
 
 	// Convert the map of posts into a slice
 	for _, post := range postMap {
+		post.RenderDescription()
 		posts = append(posts, *post)
 	}
 
@@ -638,15 +499,15 @@ func ReadPostsLikedByUserId(userId int) ([]Post, error) {
 	return posts, nil
 }
 
-func ReadPostById(postId int, checkLikeForUser int) (Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadPostById(postId int, checkLikeForUser int) (Post, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
+        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.format as post_format, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
 			(SELECT COUNT(DISTINCT id) from post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like') AS number_of_likes,
 			(SELECT COUNT(DISTINCT id) from post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
+			`+revisionCount("post", "p")+` AS revisions,
 			u.id as user_id, u.username as user_username, u.email as user_email,
 			c.id as category_id, c.name as category_name,
 			CASE 
@@ -667,7 +528,7 @@ func ReadPostById(postId int, checkLikeForUser int) (Post, error) {
 			LEFT JOIN categories c
 				ON pc.category_id = c.id
 				AND c.status = 'enable'
-		WHERE p.status != 'delete'
+		WHERE p.status NOT IN ('delete', 'draft')
 			AND u.status != 'delete';
     `, checkLikeForUser, checkLikeForUser, postId)
 	if selectError != nil {
@@ -684,9 +545,9 @@ func ReadPostById(postId int, checkLikeForUser int) (Post, error) {
 		var category Category
 
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
-			&post.NumberOfLikes, &post.NumberOfDislikes,
+			&post.NumberOfLikes, &post.NumberOfDislikes, &post.Revisions,
 			&post.UserId, &user.Username, &user.Email,
 			&category.ID, &category.Name,
 			&post.IsLikedByUser, &post.IsDislikedByUser,
@@ -717,18 +578,20 @@ func ReadPostById(postId int, checkLikeForUser int) (Post, error) {
 		return Post{}, fmt.Errorf("row iteration error: %v", err)
 	}
 
+	post.Edited = post.Revisions > 0
+	post.RenderDescription()
 	return post, nil
 }
 
-func ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
+        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.format as post_format, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
 			(SELECT COUNT(DISTINCT id) from post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like') AS number_of_likes,
 			(SELECT COUNT(DISTINCT id) from post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
+			`+revisionCount("post", "p")+` AS revisions,
 			u.id as user_id, u.username as user_username, u.email as user_email,
 			c.id as category_id, c.name as category_name,
 			CASE 
@@ -749,7 +612,7 @@ func ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
 			LEFT JOIN categories c
 				ON pc.category_id = c.id
 				AND c.status = 'enable'
-		WHERE p.status != 'delete'
+		WHERE p.status NOT IN ('delete', 'draft')
 			AND u.status != 'delete';
     `, checkLikeForUser, checkLikeForUser, postUUID)
 	if selectError != nil {
@@ -766,9 +629,9 @@ func ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
 		var category Category
 
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
-			&post.NumberOfLikes, &post.NumberOfDislikes,
+			&post.NumberOfLikes, &post.NumberOfDislikes, &post.Revisions,
 			&post.UserId, &user.Username, &user.Email,
 			&category.ID, &category.Name,
 			&post.IsLikedByUser, &post.IsDislikedByUser,
@@ -783,7 +646,7 @@ func ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
 
 	// If no rows were returned, the post doesn't exist
 	if post.ID == 0 {
-		return Post{}, fmt.Errorf("post with UUID %s not found", postUUID)
+		return Post{}, fmt.Errorf("post with UUID %s not found: %w", postUUID, sql.ErrNoRows)
 	}
 
 	// Assign categories to the post
@@ -795,15 +658,16 @@ func ReadPostByUUID(postUUID string, checkLikeForUser int) (Post, error) {
 		return Post{}, fmt.Errorf("row iteration error: %v", err)
 	}
 
+	post.Edited = post.Revisions > 0
+	post.RenderDescription()
 	return post, nil
 }
 
-func ReadPostByUserID(postId int, userID int) (Post, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *PostRepository) ReadPostByUserID(postId int, userID int) (Post, error) {
+	db := r.db
 	// Updated query to join comments with posts
 	rows, selectError := db.Query(`
-        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
+        SELECT p.id as post_id, p.uuid as post_uuid, p.title as post_title, p.description as post_description, p.format as post_format, p.status as post_status, p.created_at as post_created_at, p.updated_at as post_updated_at, p.updated_by as post_updated_by,
 			p.user_id as post_user_id, u.id as user_id, u.username as user_username, u.email as user_email,
 			c.id as category_id, c.name as category_name,
 			COALESCE(pl.type, '')
@@ -819,7 +683,7 @@ func ReadPostByUserID(postId int, userID int) (Post, error) {
 				AND c.status = 'enable'
 			LEFT JOIN post_likes pl
 				ON p.id = pl.post_id AND pl.status != 'delete'	
-		WHERE p.status != 'delete'
+		WHERE p.status NOT IN ('delete', 'draft')
 			AND u.status != 'delete';
     `, postId)
 	if selectError != nil {
@@ -836,7 +700,7 @@ func ReadPostByUserID(postId int, userID int) (Post, error) {
 		var category Category
 		var Type string
 		err := rows.Scan(
-			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Status,
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
 			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &post.UserId,
 			&user.ID, &user.Username, &user.Email,
 			&category.ID, &category.Name, &Type,
@@ -869,5 +733,6 @@ func ReadPostByUserID(postId int, userID int) (Post, error) {
 		return Post{}, fmt.Errorf("row iteration error: %v", err)
 	}
 
+	post.RenderDescription()
 	return post, nil
 }
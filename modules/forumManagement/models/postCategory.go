@@ -2,7 +2,7 @@ package models
 
 import (
 	"database/sql"
-	"fmt"
+	"log/slog"
 	"time"
 )
 
@@ -36,8 +36,7 @@ func InsertPostCategories(post_id int, categories []int, user_id int, tx *sql.Tx
 		// Execute the bulk insert query
 		_, err := tx.Exec(query, values...)
 		if err != nil {
-			fmt.Println("here is error")
-			fmt.Println(err)
+			slog.Error("Error inserting post categories", "post_id", post_id, "err", err)
 			tx.Rollback() // Rollback on error
 			return err
 		}
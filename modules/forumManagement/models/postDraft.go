@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqlTime stores times in the format of CURRENT_TIMESTAMP, so SQLite can compare them
+func sqlTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.DateTime)
+}
+
+// ReadDraftsByUserID reads the drafts of a user, scheduled ones first in the order they get published
+func (r *PostRepository) ReadDraftsByUserID(userID int) ([]Post, error) {
+	return r.readDrafts(`p.user_id = ?`, userID)
+}
+
+// ReadDraftByUUID reads a draft of the user, sql.ErrNoRows when the user has no such draft
+func (r *PostRepository) ReadDraftByUUID(draftUUID string, userID int) (Post, error) {
+	drafts, err := r.readDrafts(`p.uuid = ? AND p.user_id = ?`, draftUUID, userID)
+	if err != nil {
+		return Post{}, err
+	}
+	if len(drafts) == 0 {
+		return Post{}, fmt.Errorf("draft with UUID %s not found: %w", draftUUID, sql.ErrNoRows)
+	}
+	return drafts[0], nil
+}
+
+// ReadDueDrafts reads the scheduled drafts whose publish time has come
+func (r *PostRepository) ReadDueDrafts() ([]Post, error) {
+	return r.readDrafts(`p.publish_at <= CURRENT_TIMESTAMP`)
+}
+
+func (r *PostRepository) readDrafts(condition string, args ...any) ([]Post, error) {
+	db := r.db
+
+	rows, err := db.Query(`
+		SELECT p.id, p.uuid, p.title, p.description, p.format, p.status,
+			p.created_at, p.updated_at, p.updated_by, p.publish_at,
+			u.id, u.uuid, u.username, u.email
+		FROM posts p
+			INNER JOIN users u ON p.user_id = u.id AND u.status != 'delete'
+		WHERE p.status = 'draft'
+			AND `+condition+`
+		ORDER BY p.publish_at IS NULL, p.publish_at, p.id DESC;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Post
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
+			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy, &post.PublishAt,
+			&post.UserId, &post.User.UUID, &post.User.Username, &post.User.Email,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		post.User.ID = post.UserId
+		post.RenderDescription()
+		drafts = append(drafts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	if err := readCategoriesForPosts(db, drafts); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// UpdateDraft saves the edited title, description, format, categories and publish time of a draft
+func (r *PostRepository) UpdateDraft(post *Post, categories []int, user_id int) error {
+	db := r.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE posts
+					SET title = ?,
+						description = ?,
+						format = ?,
+						publish_at = ?,
+						updated_at = CURRENT_TIMESTAMP,
+						updated_by = ?
+					WHERE id = ?
+					AND status = 'draft';`,
+		post.Title, post.Description, post.Format, sqlTime(post.PublishAt), user_id, post.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows // The draft was published or deleted meanwhile
+	}
+
+	if err := UpdateStatusPostCategories(post.ID, user_id, "delete", tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := InsertPostCategories(post.ID, categories, user_id, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PublishDraft turns a draft into a post created now and makes it searchable.
+// Returns sql.ErrNoRows when the post is no draft anymore, so a draft is only published once
+func (r *PostRepository) PublishDraft(post *Post) error {
+	db := r.db
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE posts
+					SET status = 'enable',
+						created_at = CURRENT_TIMESTAMP,
+						publish_at = NULL
+					WHERE id = ?
+					AND status = 'draft';`, post.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	if err := indexItem(tx, "post", post.ID, post.Title, post.Description, post.Format); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	userManagementModels "real-time-forum/modules/userManagement/models"
+	"strings"
+)
+
+// Sort modes of the post feed
+const (
+	PostSortNewest    = "newest"
+	PostSortLiked     = "liked"
+	PostSortDiscussed = "discussed"
+	PostSortActivity  = "activity"
+)
+
+// postSortKeys are the SQL expressions the feed is ordered by, descending, with the post ID breaking ties
+var postSortKeys = map[string]string{
+	PostSortNewest:    `p.created_at`, // published drafts are new although their ID is older
+	PostSortLiked:     `(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like')`,
+	PostSortDiscussed: `(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id AND ` + visibleComment("cm") + `)`,
+	// Latest of creation, edit and newest comment on the post
+	PostSortActivity: `MAX(COALESCE(p.updated_at, p.created_at),
+		COALESCE((SELECT MAX(cm.created_at) FROM comments cm WHERE cm.post_id = p.id AND cm.status != 'delete'), p.created_at))`,
+}
+
+// ValidPostSort reports whether sort is a known sort mode of the feed
+func ValidPostSort(sort string) bool {
+	_, ok := postSortKeys[sort]
+	return ok
+}
+
+// ReadPostsPage reads one page of the feed, all categories when categoryID is 0.
+// Pages are keyset based: before is the ID of the last post of the previous page, or 0 for the first page,
+// and the page continues after that post's position in the chosen sort order. The newest posts are
+// read in the order of the posts(status, created_at) index. The other sorts rank the published posts
+// only, and the counts shown are read for the posts of the page alone
+func (r *PostRepository) ReadPostsPage(userID int, categoryID int, sort string, before int, limit int) ([]Post, bool, error) {
+	sortKey, ok := postSortKeys[sort]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown sort mode %q", sort)
+	}
+
+	db := r.db
+
+	// The key of the cursor post is read by its ID, so a cursor post deleted meanwhile still marks its position
+	query := `
+	WITH cursor(sort_key, id) AS (
+		SELECT ` + sortKey + `, p.id FROM posts p WHERE p.id = ?
+	),
+	page AS (
+		SELECT p.id, ` + sortKey + ` AS sort_key
+		FROM posts p
+		INNER JOIN users u ON p.user_id = u.id
+		WHERE p.status = 'enable'
+			AND u.status != 'delete'`
+	args := []any{before}
+
+	if categoryID > 0 {
+		query += `
+			AND p.id IN (
+				SELECT post_id FROM post_categories WHERE category_id = ? AND status = 'enable'
+			)`
+		args = append(args, categoryID)
+	}
+	if before > 0 {
+		// Compared as a row value, the newest posts continue with a range of the index
+		query += `
+			AND (` + sortKey + `, p.id) < (SELECT sort_key, id FROM cursor)`
+	}
+
+	// One extra row tells whether there is a next page
+	query += `
+		ORDER BY ` + sortKey + ` DESC, p.id DESC
+		LIMIT ?
+	)
+	SELECT 
+		p.id AS post_id, p.uuid AS post_uuid, p.title AS post_title, 
+		p.description AS post_description, p.format AS post_format, p.status AS post_status, 
+		p.created_at AS post_created_at, p.updated_at AS post_updated_at, 
+		p.updated_by AS post_updated_by,
+		(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like') AS number_of_likes,
+		(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike') AS number_of_dislikes,
+		(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id AND ` + visibleComment("cm") + `) AS number_of_comments,
+		` + revisionCount("post", "p") + ` AS revisions,
+		u.id AS user_id, u.username AS user_username, u.email AS user_email,
+		CASE 
+			WHEN EXISTS (SELECT 1 FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'like' AND user_id = ?) THEN 1
+			ELSE 0
+		END AS is_liked_by_user,
+		CASE 
+			WHEN EXISTS (SELECT 1 FROM post_likes WHERE post_id = p.id AND status != 'delete' AND type = 'dislike' AND user_id = ?) THEN 1
+			ELSE 0
+		END AS is_disliked_by_user
+	FROM page pg
+	INNER JOIN posts p ON p.id = pg.id
+	INNER JOIN users u ON p.user_id = u.id
+	ORDER BY pg.sort_key DESC, pg.id DESC;`
+	args = append(args, limit+1, userID, userID)
+
+	rows, selectError := db.Query(query, args...)
+	if selectError != nil {
+		return nil, false, selectError
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		var user userManagementModels.User
+
+		err := rows.Scan(
+			&post.ID, &post.UUID, &post.Title, &post.Description, &post.Format, &post.Status,
+			&post.CreatedAt, &post.UpdatedAt, &post.UpdatedBy,
+			&post.NumberOfLikes, &post.NumberOfDislikes, &post.RepliesCount, &post.Revisions,
+			&post.UserId, &user.Username, &user.Email,
+			&post.IsLikedByUser, &post.IsDislikedByUser,
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("error scanning row: %v", err)
+		}
+
+		post.User = user
+		post.Edited = post.Revisions > 0
+		post.RenderDescription()
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	if err := readCategoriesForPosts(db, posts); err != nil {
+		return nil, false, err
+	}
+
+	return posts, hasMore, nil
+}
+
+// readCategoriesForPosts fills the categories of a page of posts with a single query
+func readCategoriesForPosts(db *sql.DB, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(posts))
+	args := make([]any, len(posts))
+	index := make(map[int]int, len(posts))
+	for i, post := range posts {
+		placeholders[i] = "?"
+		args[i] = post.ID
+		index[post.ID] = i
+		posts[i].Categories = []Category{}
+	}
+
+	rows, err := db.Query(`
+		SELECT pc.post_id, c.id, c.name
+		FROM post_categories pc
+		INNER JOIN categories c ON pc.category_id = c.id AND c.status = 'enable'
+		WHERE pc.status = 'enable'
+			AND pc.post_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY pc.id;
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var category Category
+		if err := rows.Scan(&postID, &category.ID, &category.Name); err != nil {
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		i := index[postID]
+		posts[i].Categories = append(posts[i].Categories, category)
+	}
+
+	return rows.Err()
+}
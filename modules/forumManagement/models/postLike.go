@@ -3,8 +3,6 @@ package models
 import (
 	"errors"
 	"fmt"
-	"log"
-	"real-time-forum/db"
 	userManagementModels "real-time-forum/modules/userManagement/models"
 	"time"
 )
@@ -22,9 +20,8 @@ type PostLike struct {
 	Post      Post                      `json:"post"`
 }
 
-func InsertPostLike(postLike *PostLike) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) InsertPostLike(postLike *PostLike) (int, error) {
+	db := r.db
 
 	insertQuery := `INSERT INTO post_likes (type, post_id, user_id) VALUES (?, ?, ?);`
 	result, insertErr := db.Exec(insertQuery, postLike.Type, postLike.PostId, postLike.UserId)
@@ -46,17 +43,15 @@ func InsertPostLike(postLike *PostLike) (int, error) {
 	// Retrieve the last inserted ID
 	lastInsertID, err := result.LastInsertId()
 	if err != nil {
-		log.Fatal(err)
 		return -1, err
 	}
 
 	return int(lastInsertID), nil
 }
 
-func UpdateStatusPostLike(post_like_id int, status string, user_id int) error {
+func (r *LikeRepository) UpdateStatusPostLike(post_like_id int, status string, user_id int) error {
 
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+	db := r.db
 
 	updateQuery := `UPDATE post_likes
 		               SET status = ?,
@@ -70,9 +65,8 @@ func UpdateStatusPostLike(post_like_id int, status string, user_id int) error {
 	return nil
 }
 
-func ReadAllPostsLikes() ([]PostLike, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) ReadAllPostsLikes() ([]PostLike, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
@@ -84,7 +78,7 @@ func ReadAllPostsLikes() ([]PostLike, error) {
 		FROM post_likes pl
 			INNER JOIN posts p
 				ON pl.post_id = p.id	
-				AND p.status != 'delete'
+				AND p.status NOT IN ('delete', 'draft')
 			INNER JOIN users u
 				ON pl.user_id = u.id
 				AND u.status != 'delete'
@@ -149,9 +143,8 @@ func ReadAllPostsLikes() ([]PostLike, error) {
 	return postLikes, nil
 }
 
-func ReadPostsLikeByUserId(userId int) ([]PostLike, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) ReadPostsLikeByUserId(userId int) ([]PostLike, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
@@ -163,7 +156,7 @@ func ReadPostsLikeByUserId(userId int) ([]PostLike, error) {
 		FROM post_likes pl
 			INNER JOIN posts p
 				ON pl.post_id = p.id	
-				AND p.status != 'delete'
+				AND p.status NOT IN ('delete', 'draft')
 			INNER JOIN users u
 				ON pl.user_id = u.id
 				AND u.status != 'delete'
@@ -229,9 +222,8 @@ func ReadPostsLikeByUserId(userId int) ([]PostLike, error) {
 	return postLikes, nil
 }
 
-func ReadPostsLikeByPostId(postId int) ([]PostLike, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) ReadPostsLikeByPostId(postId int) ([]PostLike, error) {
+	db := r.db
 
 	// Query the records
 	rows, selectError := db.Query(`
@@ -243,7 +235,7 @@ func ReadPostsLikeByPostId(postId int) ([]PostLike, error) {
 		FROM post_likes pl
 			INNER JOIN posts p
 				ON pl.post_id = p.id	
-				AND p.status != 'delete'
+				AND p.status NOT IN ('delete', 'draft')
 				AND p.id = ?
 			INNER JOIN users u
 				ON pl.user_id = u.id
@@ -309,9 +301,8 @@ func ReadPostsLikeByPostId(postId int) ([]PostLike, error) {
 	return postLikes, nil
 }
 
-func PostHasLike(userId int, postID int) (int, string) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *LikeRepository) PostHasLike(userId int, postID int) (int, string) {
+	db := r.db
 	var existingLikeId int
 	var existingLikeType string
 	likeCheckQuery := `SELECT id, type
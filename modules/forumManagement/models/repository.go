@@ -0,0 +1,45 @@
+package models
+
+import "database/sql"
+
+// Repositories read and write the forum tables through the shared database they're created with
+type (
+	CategoryRepository struct{ db *sql.DB }
+	ChatRepository     struct{ db *sql.DB }
+	CommentRepository  struct{ db *sql.DB }
+	LikeRepository     struct{ db *sql.DB }
+	PostRepository     struct{ db *sql.DB }
+	RevisionRepository struct{ db *sql.DB }
+	SearchRepository   struct{ db *sql.DB }
+)
+
+func NewCategoryRepository(db *sql.DB) *CategoryRepository { return &CategoryRepository{db: db} }
+func NewChatRepository(db *sql.DB) *ChatRepository         { return &ChatRepository{db: db} }
+func NewCommentRepository(db *sql.DB) *CommentRepository   { return &CommentRepository{db: db} }
+func NewLikeRepository(db *sql.DB) *LikeRepository         { return &LikeRepository{db: db} }
+func NewPostRepository(db *sql.DB) *PostRepository         { return &PostRepository{db: db} }
+func NewRevisionRepository(db *sql.DB) *RevisionRepository { return &RevisionRepository{db: db} }
+func NewSearchRepository(db *sql.DB) *SearchRepository     { return &SearchRepository{db: db} }
+
+// The repositories the handlers use, set up once by Use
+var (
+	Categories  *CategoryRepository
+	Chats       *ChatRepository
+	Comments    *CommentRepository
+	Likes       *LikeRepository
+	Posts       *PostRepository
+	Revisions   *RevisionRepository
+	SearchIndex *SearchRepository
+)
+
+// Use points the forum repositories at db, the server calls it at startup and tests
+// can call it with an in-memory database
+func Use(db *sql.DB) {
+	Categories = NewCategoryRepository(db)
+	Chats = NewChatRepository(db)
+	Comments = NewCommentRepository(db)
+	Likes = NewLikeRepository(db)
+	Posts = NewPostRepository(db)
+	Revisions = NewRevisionRepository(db)
+	SearchIndex = NewSearchRepository(db)
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	userManagementModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"time"
+)
+
+// Revision is one version of a post or comment, numbered from 1 for the original
+type Revision struct {
+	Number          int                       `json:"number"`
+	Title           string                    `json:"title,omitempty"` // posts only
+	Description     string                    `json:"description"`
+	Format          string                    `json:"format"`
+	DescriptionHTML string                    `json:"description_html"`
+	CreatedAt       time.Time                 `json:"created_at"`
+	User            userManagementModels.User `json:"user"` // who wrote this version
+	Current         bool                      `json:"current"`
+}
+
+// revisionTables hold the current versions of posts and comments, comments have no title
+var revisionTables = map[string]struct{ table, title string }{
+	"post":    {table: "posts", title: "v.title"},
+	"comment": {table: "comments", title: "''"},
+}
+
+// insertRevision keeps the current version of a post or comment before it's overwritten by an edit.
+// Nothing is kept when the edit doesn't change the title, description or format
+func insertRevision(exec execer, kind string, id int, title string, description string, format string) error {
+	source := revisionTables[kind]
+	_, err := exec.Exec(`
+		INSERT INTO revisions (kind, ref_id, title, description, format, created_at, created_by)
+		SELECT ?, v.id, `+source.title+`, v.description, v.format,
+			COALESCE(v.updated_at, v.created_at), COALESCE(v.updated_by, v.user_id)
+		FROM `+source.table+` v
+		WHERE v.id = ?
+			AND (`+source.title+` != ? OR v.description != ? OR v.format != ?);
+	`, kind, id, title, description, format)
+	return err
+}
+
+// ReadRevisions reads all versions of a post or comment, oldest first and the current one last
+func (r *RevisionRepository) ReadRevisions(kind string, id int) ([]Revision, error) {
+	source, ok := revisionTables[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown revision kind %q", kind)
+	}
+
+	db := r.db
+
+	rows, err := db.Query(`
+		SELECT r.title, r.description, r.format, r.created_at,
+			u.id, u.uuid, u.username
+		FROM revisions r
+			INNER JOIN users u ON u.id = r.created_by
+		WHERE r.kind = ? AND r.ref_id = ?
+		ORDER BY r.id;
+	`, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(
+			&revision.Title, &revision.Description, &revision.Format, &revision.CreatedAt,
+			&revision.User.ID, &revision.User.UUID, &revision.User.Username,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	// The current version was written by its last editor, or by its author when it was never edited
+	current := Revision{Current: true}
+	var updatedAt *time.Time
+	err = db.QueryRow(`
+		SELECT `+source.title+`, v.description, v.format, v.created_at, v.updated_at,
+			u.id, u.uuid, u.username
+		FROM `+source.table+` v
+			INNER JOIN users u ON u.id = COALESCE(v.updated_by, v.user_id)
+		WHERE v.id = ?;
+	`, id).Scan(
+		&current.Title, &current.Description, &current.Format, &current.CreatedAt, &updatedAt,
+		&current.User.ID, &current.User.UUID, &current.User.Username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if updatedAt != nil {
+		current.CreatedAt = *updatedAt
+	}
+	revisions = append(revisions, current)
+
+	for i := range revisions {
+		revisions[i].Number = i + 1
+		revisions[i].DescriptionHTML = utils.RenderText(revisions[i].Description, revisions[i].Format)
+	}
+
+	return revisions, nil
+}
+
+// revisionCount is an SQL expression counting the kept revisions of the post or comment under alias
+func revisionCount(kind string, alias string) string {
+	return `(SELECT COUNT(*) FROM revisions WHERE kind = '` + kind + `' AND ref_id = ` + alias + `.id)`
+}
@@ -0,0 +1,411 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"real-time-forum/utils"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Snippet highlight markers, replaced by <mark> tags once the snippet is HTML escaped
+const (
+	highlightStart = "\uE000"
+	highlightEnd   = "\uE001"
+)
+
+// execer is a *sql.DB or a *sql.Tx, so the index is updated in the caller's transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SearchFilter narrows a search, zero values don't filter
+type SearchFilter struct {
+	CategoryID int
+	Author     string    // username
+	From       time.Time // inclusive
+	To         time.Time // exclusive
+}
+
+// SearchResult is a matching post or comment, comments point to the post of their thread
+type SearchResult struct {
+	Kind      string    `json:"kind"` // post or comment
+	ID        int       `json:"id"`
+	PostID    int       `json:"postId"`
+	PostUUID  string    `json:"postUuid"`
+	PostTitle string    `json:"postTitle"`
+	Snippet   string    `json:"snippet"` // HTML escaped, matches wrapped in <mark>
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	Rank      float64   `json:"rank"` // lower is better
+}
+
+// snippetRunes is the length of snippets built without FTS5
+const snippetRunes = 160
+
+// fullTextSearch is set by RefreshSearchIndex when SQLite has FTS5, otherwise searches fall back to LIKE
+var fullTextSearch bool
+
+// FullTextSearch reports whether searches are ranked by the FTS5 index
+func FullTextSearch() bool {
+	return fullTextSearch
+}
+
+// RefreshSearchIndex brings the search index up to date when the server starts, and reports whether
+// it rebuilt anything. Migration 0007_search_index creates the documents, they're rebuilt when marked
+// stale, e.g. after seeding. With FTS5 their search_fts index is created when it's missing and refilled
+// when documents were written without it, without FTS5 searches fall back to LIKE
+func (r *SearchRepository) RefreshSearchIndex() (bool, error) {
+	db := r.db
+
+	var hasFTS5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5');`).Scan(&hasFTS5); err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	stale, synced := true, false // Without the state row everything is rebuilt
+	err = tx.QueryRow(`SELECT stale, fts_synced FROM search_index_state WHERE id = 1;`).Scan(&stale, &synced)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	rebuilt := stale
+	if stale {
+		if err := rebuildSearchDocuments(tx); err != nil {
+			return false, err
+		}
+	}
+
+	if hasFTS5 {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE name = 'search_fts');`).Scan(&exists)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			_, err := tx.Exec(`CREATE VIRTUAL TABLE search_fts USING fts5(
+				title,
+				body,
+				tokenize = 'unicode61 remove_diacritics 2'
+			);`)
+			if err != nil {
+				return false, err
+			}
+		}
+		if !exists || stale || !synced {
+			for _, query := range []string{
+				`DELETE FROM search_fts;`,
+				`INSERT INTO search_fts (rowid, title, body) SELECT id, title, body FROM search_documents;`,
+			} {
+				if _, err := tx.Exec(query); err != nil {
+					return false, err
+				}
+			}
+			rebuilt = true
+		}
+	}
+
+	// Without FTS5 the documents change from now on without the index
+	_, err = tx.Exec(`INSERT INTO search_index_state (id, stale, fts_synced) VALUES (1, 0, ?)
+		ON CONFLICT (id) DO UPDATE SET stale = 0, fts_synced = excluded.fts_synced;`, hasFTS5)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	fullTextSearch = hasFTS5
+	return rebuilt, nil
+}
+
+// rebuildSearchDocuments refills the documents from the enabled posts and comments
+func rebuildSearchDocuments(tx *sql.Tx) error {
+	type item struct {
+		kind, title, body, format string
+		id                        int
+	}
+
+	rows, err := tx.Query(`
+		SELECT 'post', id, title, description, format FROM posts WHERE status = 'enable'
+		UNION ALL
+		SELECT 'comment', id, '', description, format FROM comments WHERE status = 'enable';`)
+	if err != nil {
+		return err
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.kind, &it.id, &it.title, &it.body, &it.format); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM search_documents;`); err != nil {
+		return err
+	}
+	for _, it := range items {
+		if _, err := insertSearchDocument(tx, it.kind, it.id, it.title, it.body, it.format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexItem adds or replaces a post or comment in the search index
+func indexItem(exec execer, kind string, id int, title string, body string, format string) error {
+	if err := unindexItem(exec, kind, id); err != nil {
+		return err
+	}
+	documentID, err := insertSearchDocument(exec, kind, id, title, body, format)
+	if err != nil || documentID == 0 || !fullTextSearch {
+		return err
+	}
+	_, err = exec.Exec(`INSERT INTO search_fts (rowid, title, body)
+		SELECT id, title, body FROM search_documents WHERE id = ?;`, documentID)
+	return err
+}
+
+// insertSearchDocument stores the plain text of a post or comment with the post of its thread,
+// found once here so searches don't walk the reply trees. Returns the ID of the document,
+// 0 when a comment isn't in a post's thread
+func insertSearchDocument(exec execer, kind string, id int, title string, body string, format string) (int64, error) {
+	body = utils.PlainText(body, format)
+
+	var result sql.Result
+	var err error
+	if kind == "post" {
+		result, err = exec.Exec(`INSERT INTO search_documents (kind, ref_id, post_id, title, body)
+			VALUES ('post', ?, ?, ?, ?);`, id, id, title, body)
+	} else {
+		result, err = exec.Exec(`
+			WITH RECURSIVE ancestors(post_id, comment_id) AS (
+				SELECT post_id, comment_id FROM comments WHERE id = ?
+				UNION ALL
+				SELECT c.post_id, c.comment_id FROM comments c INNER JOIN ancestors a ON c.id = a.comment_id
+			)
+			INSERT INTO search_documents (kind, ref_id, post_id, title, body)
+			SELECT 'comment', ?, post_id, '', ? FROM ancestors WHERE post_id IS NOT NULL;`, id, id, body)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return 0, nil
+	}
+	return result.LastInsertId()
+}
+
+// unindexItem removes a deleted post or comment from the search index
+func unindexItem(exec execer, kind string, id int) error {
+	if fullTextSearch {
+		_, err := exec.Exec(`DELETE FROM search_fts WHERE rowid IN (
+			SELECT id FROM search_documents WHERE kind = ? AND ref_id = ?
+		);`, kind, id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := exec.Exec(`DELETE FROM search_documents WHERE kind = ? AND ref_id = ?;`, kind, id)
+	return err
+}
+
+// SearchTerms splits a user query into words, so FTS5 query syntax in it is never interpreted
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Search finds posts and comments containing all terms, best matches first.
+// Returns one page and whether there are more
+func (r *SearchRepository) Search(terms []string, filter SearchFilter, page int, limit int) ([]SearchResult, bool, error) {
+	if len(terms) == 0 {
+		return nil, false, nil
+	}
+
+	db := r.db
+
+	var source, match, snippet, rank string
+	var args []any
+	if fullTextSearch {
+		source = `search_fts INNER JOIN search_documents d ON d.id = search_fts.rowid`
+		match = `search_fts MATCH ?`
+		// Every term must match, the last one also as a prefix of a word
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"`
+		}
+		quoted[len(quoted)-1] += "*"
+		snippet = `snippet(search_fts, -1, ?, ?, '…', 16)`
+		rank = `bm25(search_fts, 5.0, 1.0)` // title matches weigh more
+		args = append(args, highlightStart, highlightEnd, strings.Join(quoted, " "))
+	} else {
+		source = `search_documents d`
+		conditions := make([]string, len(terms))
+		for i, term := range terms {
+			conditions[i] = `(d.title LIKE ? OR d.body LIKE ?)`
+			pattern := "%" + term + "%"
+			args = append(args, pattern, pattern)
+		}
+		match = strings.Join(conditions, " AND ")
+		snippet = `CASE WHEN d.title != '' THEN d.title || ' — ' || d.body ELSE d.body END`
+		rank = `0`
+	}
+
+	query := `
+	SELECT d.kind, d.ref_id, p.id, p.uuid, p.title, u.username, p.created_at, c.created_at,
+		` + snippet + ` AS snippet,
+		` + rank + ` AS rank
+	FROM ` + source + `
+		INNER JOIN posts p ON p.id = d.post_id
+		LEFT JOIN comments c ON d.kind = 'comment' AND c.id = d.ref_id
+		INNER JOIN users u ON u.id = COALESCE(c.user_id, p.user_id)
+	WHERE ` + match + `
+		AND p.status = 'enable'
+		AND (c.id IS NULL OR c.status = 'enable')
+		AND u.status != 'delete'`
+
+	if filter.CategoryID > 0 {
+		query += `
+		AND p.id IN (SELECT post_id FROM post_categories WHERE category_id = ? AND status = 'enable')`
+		args = append(args, filter.CategoryID)
+	}
+	if filter.Author != "" {
+		query += `
+		AND u.username = ?`
+		args = append(args, filter.Author)
+	}
+	if !filter.From.IsZero() {
+		query += `
+		AND COALESCE(c.created_at, p.created_at) >= ?`
+		args = append(args, filter.From.UTC().Format(time.DateTime))
+	}
+	if !filter.To.IsZero() {
+		query += `
+		AND COALESCE(c.created_at, p.created_at) < ?`
+		args = append(args, filter.To.UTC().Format(time.DateTime))
+	}
+
+	// One extra row tells whether there is a next page
+	query += `
+	ORDER BY rank, COALESCE(c.created_at, p.created_at) DESC
+	LIMIT ? OFFSET ?;`
+	args = append(args, limit+1, (page-1)*limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var postCreatedAt, commentCreatedAt sql.NullTime
+		var snippetText string
+		err := rows.Scan(
+			&result.Kind, &result.ID, &result.PostID, &result.PostUUID, &result.PostTitle, &result.Author,
+			&postCreatedAt, &commentCreatedAt, &snippetText, &result.Rank,
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("error scanning row: %v", err)
+		}
+
+		result.CreatedAt = postCreatedAt.Time
+		if commentCreatedAt.Valid {
+			result.CreatedAt = commentCreatedAt.Time
+		}
+		if !fullTextSearch {
+			snippetText = highlightTerms(snippetText, terms)
+		}
+		result.Snippet = highlightHTML(snippetText)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	return results, hasMore, nil
+}
+
+// highlightTerms cuts a snippet around the first term found and marks every term, for searches without FTS5
+func highlightTerms(text string, terms []string) string {
+	lower := []rune(strings.ToLower(text))
+	runes := []rune(text)
+	if len(lower) != len(runes) {
+		lower = runes // case folding changed the length, match case sensitively
+	}
+
+	// Start the snippet a little before the first match
+	first := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, []rune(strings.ToLower(term))); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	start := max(first-snippetRunes/4, 0)
+	end := min(start+snippetRunes, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := 0
+		for _, term := range terms {
+			termRunes := []rune(strings.ToLower(term))
+			if i+len(termRunes) <= len(lower) && string(lower[i:i+len(termRunes)]) == string(termRunes) {
+				matched = max(matched, len(termRunes))
+			}
+		}
+		if matched > 0 {
+			b.WriteString(highlightStart + string(runes[i:i+matched]) + highlightEnd)
+			i += matched
+			continue
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func indexRunes(s []rune, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if string(s[i:i+len(sub)]) == string(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// highlightHTML escapes user text and turns the highlight markers into <mark> tags
+func highlightHTML(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
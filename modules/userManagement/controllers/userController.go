@@ -2,11 +2,13 @@ package controller
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
-	"net/mail"
 	"real-time-forum/config"
 	userModels "real-time-forum/modules/userManagement/models"
+	"real-time-forum/utils"
+	"real-time-forum/validation"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -19,9 +21,10 @@ type AuthPageErrorData struct {
 
 func SessionGenerator(w http.ResponseWriter, r *http.Request, userId int) (string, error) {
 	session := &userModels.Session{
-		UserId: userId,
+		UserId:    userId,
+		ExpiresAt: time.Now().Add(config.Current().Session.TTL.Duration),
 	}
-	session, insertError := userModels.InsertSession(session)
+	session, insertError := userModels.Sessions.InsertSession(session)
 	if insertError != nil {
 		return "", insertError
 	}
@@ -42,7 +45,7 @@ func ValidateSession(w http.ResponseWriter, r *http.Request) (bool, userModels.U
 	}
 
 	sessionToken := cookie.Value
-	user, expirationTime, selectError := userModels.SelectSession(sessionToken)
+	user, expirationTime, selectError := userModels.Sessions.SelectSession(sessionToken)
 	if selectError != nil {
 		if selectError.Error() == "sql: no rows in result set" {
 			DeleteCookie(w, "session_token")
@@ -56,6 +59,7 @@ func ValidateSession(w http.ResponseWriter, r *http.Request) (bool, userModels.U
 	if time.Now().After(expirationTime) {
 		return false, userModels.User{}, "", nil
 	}
+	utils.SetRequestUser(r.Context(), user.UUID)
 	return true, user, sessionToken, nil
 }
 
@@ -72,7 +76,7 @@ func HandleSessionCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]any{"loggedIn": true, "token": sessionToken, "username": user.Username})
+	json.NewEncoder(w).Encode(map[string]any{"loggedIn": true, "token": sessionToken, "username": user.Username, "isAdmin": user.Type == "admin"})
 }
 
 func HandleLogin(w http.ResponseWriter, r *http.Request) {
@@ -82,10 +86,10 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	json.NewDecoder(r.Body).Decode(&creds)
-	userID, err := userModels.AuthenticateUser(creds.UsernameOrEmail, creds.Password)
+	userID, err := userModels.Users.AuthenticateUser(creds.UsernameOrEmail, creds.Password)
 
 	if err != nil {
-		fmt.Println("Error authenticating user:", err.Error())
+		slog.WarnContext(r.Context(), "Error authenticating user", "err", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -95,30 +99,33 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	sessionToken, sessionErr := SessionGenerator(w, r, userID)
 	if sessionErr != nil {
-		fmt.Println("Error creating session:", sessionErr.Error())
+		slog.ErrorContext(r.Context(), "Error creating session", "err", sessionErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
 		})
+		return
 	}
 
-	username, err := userModels.FindUsernameByID(userID)
+	user, _, err := userModels.Sessions.SelectSession(sessionToken)
 	if err != nil {
-		fmt.Println("Error creating session:", err.Error())
+		slog.ErrorContext(r.Context(), "Error reading new session", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
 		})
+		return
 	}
+	utils.SetRequestUser(r.Context(), user.UUID)
 
-	json.NewEncoder(w).Encode(map[string]any{"success": true, "token": sessionToken, "username": username})
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "token": sessionToken, "username": user.Username, "isAdmin": user.Type == "admin"})
 }
 
 func HandleLogout(w http.ResponseWriter, r *http.Request) {
 	_, user, sessionToken, _ := ValidateSession(w, r)
 
 	if sessionToken != "" {
-		err := userModels.DeleteSession(sessionToken)
+		err := userModels.Sessions.DeleteSession(sessionToken)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]any{
@@ -130,14 +137,11 @@ func HandleLogout(w http.ResponseWriter, r *http.Request) {
 
 		DeleteCookie(w, "session_token")
 
-		config.Mu.Lock()
-		delete(config.Clients, user.UUID)
-		config.Mu.Unlock()
+		// Closing the connections lets the WebSocket handler unregister them
+		config.DisconnectUser(user.UUID)
 	}
 
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
-
-	config.TellAllToUpdateClients()
 }
 
 func HandleMyProfile(w http.ResponseWriter, r *http.Request) {
@@ -163,21 +167,29 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 	// allow registering new user while logged in
 
 	var creds userModels.User
-	json.NewDecoder(r.Body).Decode(&creds)
-
-	_, emailErr := mail.ParseAddress(creds.Email)
-	if emailErr != nil {
-		fmt.Println("Error parsing email", emailErr.Error())
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
-			"message": "Invalid e-mail",
+			"message": "Invalid request",
 		})
 		return
 	}
+
+	err := validation.Registration(creds.Username, creds.Age, creds.Gender, creds.FirstName, creds.LastName, creds.Email, creds.Password)
+	if err != nil {
+		validation.WriteErrors(w, err)
+		return
+	}
+	creds.Username = strings.TrimSpace(creds.Username)
+	creds.Age = strings.TrimSpace(creds.Age)
+	creds.FirstName = strings.TrimSpace(creds.FirstName)
+	creds.LastName = strings.TrimSpace(creds.LastName)
+	creds.Email = strings.TrimSpace(creds.Email)
+
 	hashPass, cryptErr := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if cryptErr != nil {
-		fmt.Println("Error hashing password", cryptErr.Error())
+		slog.ErrorContext(r.Context(), "Error hashing password", "err", cryptErr)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -187,9 +199,9 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	creds.Password = string(hashPass)
 	// Insert a record while checking duplicates
-	_, insertError := userModels.InsertUser(&creds)
+	_, insertError := userModels.Users.InsertUser(&creds)
 	if insertError != nil {
-		fmt.Println("Error inserting user", insertError.Error())
+		slog.WarnContext(r.Context(), "Error inserting user", "err", insertError)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]any{
 			"success": false,
@@ -202,21 +214,26 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteCookie(w http.ResponseWriter, cookieName string) {
+	session := config.Current().Session
 	http.SetCookie(w, &http.Cookie{
-		Name:    cookieName,
-		Value:   "",              // Optional but recommended
-		Expires: time.Unix(0, 0), // Set expiration to a past date
-		MaxAge:  -1,              // Ensure immediate removal
-		Path:    "/",             // Must match the original cookie path
+		Name:     cookieName,
+		Value:    "",              // Optional but recommended
+		Expires:  time.Unix(0, 0), // Set expiration to a past date
+		MaxAge:   -1,              // Ensure immediate removal
+		Path:     "/",             // Must match the original cookie path
+		Secure:   session.CookieSecure,
+		SameSite: session.SameSite(),
 	})
 }
 
 func SetCookie(w http.ResponseWriter, sessionToken string, expiresAt time.Time) {
+	session := config.Current().Session
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    sessionToken,
 		Expires:  expiresAt,
 		HttpOnly: true,
-		Secure:   false,
+		Secure:   session.CookieSecure,
+		SameSite: session.SameSite(),
 	})
 }
@@ -0,0 +1,25 @@
+package models
+
+import "database/sql"
+
+// Repositories read and write the user tables through the shared database they're created with
+type (
+	UserRepository    struct{ db *sql.DB }
+	SessionRepository struct{ db *sql.DB }
+)
+
+func NewUserRepository(db *sql.DB) *UserRepository       { return &UserRepository{db: db} }
+func NewSessionRepository(db *sql.DB) *SessionRepository { return &SessionRepository{db: db} }
+
+// The repositories the handlers use, set up once by Use
+var (
+	Users    *UserRepository
+	Sessions *SessionRepository
+)
+
+// Use points the user repositories at db, the server calls it at startup and tests
+// can call it with an in-memory database
+func Use(db *sql.DB) {
+	Users = NewUserRepository(db)
+	Sessions = NewSessionRepository(db)
+}
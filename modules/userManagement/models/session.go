@@ -3,8 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"log"
-	"real-time-forum/db"
+	"log/slog"
 	"real-time-forum/utils"
 	"time"
 )
@@ -18,9 +17,9 @@ type Session struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 }
 
-func InsertSession(session *Session) (*Session, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+// InsertSession starts a session lasting until its ExpiresAt and ends the earlier sessions of the user
+func (r *SessionRepository) InsertSession(session *Session) (*Session, error) {
+	db := r.db
 
 	// Generate UUID for the user if not already set
 	if session.SessionToken == "" {
@@ -31,9 +30,6 @@ func InsertSession(session *Session) (*Session, error) {
 		session.SessionToken = uuidSessionTokenid
 	}
 
-	// Set session expiration time
-	session.ExpiresAt = time.Now().Add(12 * time.Hour)
-
 	// Start a transaction for atomicity
 	tx, err := db.Begin()
 	if err != nil {
@@ -69,9 +65,8 @@ func InsertSession(session *Session) (*Session, error) {
 	return session, nil
 }
 
-func SelectSession(sessionToken string) (User, time.Time, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *SessionRepository) SelectSession(sessionToken string) (User, time.Time, error) {
+	db := r.db
 
 	var user User
 	var expirationTime time.Time
@@ -93,16 +88,15 @@ func SelectSession(sessionToken string) (User, time.Time, error) {
 	}
 	return user, expirationTime, nil
 }
-func DeleteSession(sessionToken string) error {
+func (r *SessionRepository) DeleteSession(sessionToken string) error {
 
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+	db := r.db
 	_, err := db.Exec(`UPDATE sessions
 					SET expires_at = CURRENT_TIMESTAMP
 					WHERE session_token = ?;`, sessionToken)
 	if err != nil {
 		// Handle other database errors
-		log.Fatal(err)
+		slog.Error("Error deleting session", "err", err)
 		return errors.New("database error")
 	}
 
@@ -3,10 +3,8 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 
-	"log"
-	"real-time-forum/db"
+	"log/slog"
 	"real-time-forum/utils"
 	"time"
 
@@ -32,9 +30,8 @@ type User struct {
 	UpdatedBy      *int       `json:"updated_by"`
 }
 
-func InsertUser(user *User) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *UserRepository) InsertUser(user *User) (int, error) {
+	db := r.db
 
 	// Generate UUID for the user if not already set
 	if user.UUID == "" {
@@ -76,17 +73,15 @@ func InsertUser(user *User) (int, error) {
 	// Retrieve the last inserted ID
 	userId, err := result.LastInsertId()
 	if err != nil {
-		log.Fatal(err)
 		return -1, err
 	}
 
 	return int(userId), nil
 }
 
-func AuthenticateUser(input, password string) (int, error) {
+func (r *UserRepository) AuthenticateUser(input, password string) (int, error) {
 	// Open SQLite database
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+	db := r.db
 
 	// Query to retrieve the hashed password stored in the database for the given username
 	var userID int
@@ -111,9 +106,8 @@ func AuthenticateUser(input, password string) (int, error) {
 	return userID, nil
 }
 
-func FindUserByUUID(UUID string) (int, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *UserRepository) FindUserByUUID(UUID string) (int, error) {
+	db := r.db
 
 	selectQuery := `
 		SELECT
@@ -129,16 +123,15 @@ func FindUserByUUID(UUID string) (int, error) {
 	var id int
 	for idRow.Next() {
 		if err := idRow.Scan(&id); err != nil {
-			fmt.Printf("Failed to scan row: %v\n", err)
+			slog.Error("Failed to scan row", "err", err)
 		}
 	}
 
 	return id, nil
 }
 
-func FindUsernameByID(ID int) (string, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *UserRepository) FindUsernameByID(ID int) (string, error) {
+	db := r.db
 
 	selectQuery := `
 		SELECT
@@ -154,16 +147,15 @@ func FindUsernameByID(ID int) (string, error) {
 	var name string
 	for idRow.Next() {
 		if err := idRow.Scan(&name); err != nil {
-			fmt.Printf("Failed to scan row: %v\n", err)
+			slog.Error("Failed to scan row", "err", err)
 		}
 	}
 
 	return name, nil
 }
 
-func FindUsername(UUID string) (string, error) {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *UserRepository) FindUsername(UUID string) (string, error) {
+	db := r.db
 
 	selectQuery := `
 		SELECT
@@ -179,16 +171,15 @@ func FindUsername(UUID string) (string, error) {
 	var username string
 	for idRow.Next() {
 		if err := idRow.Scan(&username); err != nil {
-			fmt.Printf("Failed to scan row: %v\n", err)
+			slog.Error("Failed to scan row", "err", err)
 		}
 	}
 
 	return username, nil
 }
 
-func UpdateOnlineTime(UserUUID string) error {
-	db := db.OpenDBConnection()
-	defer db.Close() // Close the connection after the function finishes
+func (r *UserRepository) UpdateOnlineTime(UserUUID string) error {
+	db := r.db
 
 	updateQuery := `UPDATE users
 	SET 
@@ -196,7 +187,7 @@ func UpdateOnlineTime(UserUUID string) error {
 	WHERE uuid = ?;`
 	_, updateErr := db.Exec(updateQuery, UserUUID)
 	if updateErr != nil {
-		fmt.Println(updateErr)
+		slog.Error("Error updating last time online", "user", UserUUID, "err", updateErr)
 		return updateErr
 	}
 	return nil
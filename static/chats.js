@@ -1,11 +1,11 @@
-import { formatDate } from "./createposts.js";
-import { logout, ws } from "./realtime.js";
+import { createMarkdownToggle, formatDate, showRenderedText } from "./createposts.js";
+import { logout, showForum, ws } from "./realtime.js";
 
-let messagesAmount = 10;
-let previousScrollPosition = 0;
-let currentChatUUID = '';
+let oldestMessageID = 0;
+let hasMoreMessages = false;
+export let currentChatUUID = '';
 export let previousReceiver = '';
-export let thisUser = '';
+let listedUsers = []; // users of the last listing, to pick group members by username
 
 export function getUsersListing() {
     fetch(`/api/userslist`)
@@ -22,11 +22,35 @@ export function getUsersListing() {
         });
 }
 
-export function sendMessage(UserUUID, ChatUUID, content) {
+let requestCounter = 0;
+
+// Send a request frame over the WebSocket, falls back to HTTP while it isn't open
+function wsRequest(frame, fallback) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        fallback();
+        return;
+    }
+    requestCounter++;
+    ws.send(JSON.stringify({ ...frame, id: String(requestCounter) }));
+}
+
+// Acks need no handling, the results arrive as regular chat events
+export function handleRequestReply(msg) {
+    if (msg.msgType == "error") {
+        console.log(`request ${msg.id} failed: ${msg.code}`, msg.message);
+    }
+}
+
+export function sendMessage(UserUUID, ChatUUID, content, markdown) {
+    wsRequest({ type: "sendMessage", chatUUID: ChatUUID, to: UserUUID, content, markdown },
+        () => sendMessageHTTP(UserUUID, ChatUUID, content, markdown));
+}
+
+function sendMessageHTTP(UserUUID, ChatUUID, content, markdown) {
     fetch(`/api/sendmessage?UserUUID=${UserUUID}&ChatUUID=${ChatUUID}`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ content })
+        body: JSON.stringify({ content, markdown })
     })
         .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
         .then(data => {
@@ -43,11 +67,131 @@ export function sendMessage(UserUUID, ChatUUID, content) {
         });
 }
 
-export function showMessages(ChatUUID, UserUUID, numberOfMessages) {
+export function markRead(ChatUUID) {
+    wsRequest({ type: "markRead", chatUUID: ChatUUID }, () => markReadHTTP(ChatUUID));
+}
+
+function markReadHTTP(ChatUUID) {
+    fetch(`/api/markread?ChatUUID=${ChatUUID}`, { method: "POST" })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log('error marking chat read')
+                }
+            }
+        });
+}
+
+export function editMessage(MessageID, content, markdown) {
+    fetch(`/api/editmessage?MessageID=${MessageID}`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ content, markdown })
+    })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log('error editing message')
+                }
+            }
+        });
+}
+
+export function deleteMessage(MessageID) {
+    fetch(`/api/deletemessage?MessageID=${MessageID}`, { method: "POST" })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log('error deleting message')
+                }
+            }
+        });
+}
+
+function groupRequest(url, body, errorMessage, onSuccess) {
+    fetch(url, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body)
+    })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log(errorMessage, data.message || '')
+                    if (data.message) alert(data.message);
+                }
+            } else if (onSuccess) {
+                onSuccess(data);
+            }
+        });
+}
+
+// Comma separated usernames to user UUIDs, unknown names are reported and skipped
+function memberUUIDs(usernames) {
+    const uuids = [];
+    usernames.split(',').map(name => name.trim()).filter(name => name !== '').forEach(name => {
+        const user = listedUsers.find(u => u.username.toLowerCase() === name.toLowerCase());
+        if (user) {
+            uuids.push(user.userUuid);
+        } else {
+            alert(`Unknown user: ${name}`);
+        }
+    });
+    return uuids;
+}
+
+export function createGroup() {
+    const name = prompt('Group name');
+    if (!name || name.trim() === '') return;
+    const members = memberUUIDs(prompt('Members (comma separated usernames)') || '');
+    if (members.length === 0) return;
+    groupRequest(`/api/creategroup`, { name, members }, 'error creating group',
+        data => showMessages(data.chatUUID, data.chatUUID));
+}
+
+function renameGroup(ChatUUID, currentName) {
+    const name = prompt('Group name', currentName);
+    if (!name || name.trim() === '') return;
+    groupRequest(`/api/renamegroup?ChatUUID=${ChatUUID}`, { name }, 'error renaming group');
+}
+
+function addGroupMembers(ChatUUID) {
+    const members = memberUUIDs(prompt('Add members (comma separated usernames)') || '');
+    if (members.length === 0) return;
+    groupRequest(`/api/addgroupmembers?ChatUUID=${ChatUUID}`, { members }, 'error adding members');
+}
+
+function leaveGroup(ChatUUID) {
+    if (!confirm('Leave this group?')) return;
+    groupRequest(`/api/leavegroup?ChatUUID=${ChatUUID}`, {}, 'error leaving group', () => {
+        showForum();
+        getUsersListing();
+    });
+}
+
+// cursor is empty for the latest page, { before: id } for older or { after: id } for newer messages
+export function showMessages(ChatUUID, UserUUID, cursor = {}) {
+    wsRequest({ type: "loadHistory", chatUUID: ChatUUID, to: UserUUID, ...cursor },
+        () => showMessagesHTTP(ChatUUID, UserUUID, cursor));
+}
+
+function showMessagesHTTP(ChatUUID, UserUUID, cursor) {
     fetch(`/api/showmessages?UserUUID=${UserUUID}&ChatUUID=${ChatUUID}`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ numberOfMessages })
+        body: JSON.stringify(cursor)
     })
         .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
         .then(data => {
@@ -63,6 +207,42 @@ export function showMessages(ChatUUID, UserUUID, numberOfMessages) {
 }
 
 
+function fillGroup(group, userList) {
+    const groupRow = document.createElement('div');
+    groupRow.classList.add('row', 'chat-user', 'chat-group', 'clickable');
+    groupRow.id = 'listedUser' + group.userUuid;
+
+    const indicator = document.createElement('div');
+    indicator.className = 'typing-indicator';
+    for (let i = 0; i < 3; i++) {
+        const dot = document.createElement('span');
+        dot.className = 'bouncer';
+        indicator.appendChild(dot);
+    }
+    groupRow.appendChild(indicator);
+
+    const name = document.createElement('span');
+    name.classList.add('chat-user-name');
+    name.textContent = group.username;
+    groupRow.appendChild(name)
+
+    const members = document.createElement('span');
+    members.classList.add('chat-user-status');
+    members.textContent = `${group.memberCount} members`;
+    groupRow.appendChild(members)
+
+    if (group.unreadCount > 0) {
+        const unread = document.createElement('span');
+        unread.classList.add('chat-user-unread');
+        unread.textContent = `${group.unreadCount} new`;
+        groupRow.appendChild(unread)
+    }
+
+    // A group is addressed by its chat UUID
+    groupRow.addEventListener('click', () => showMessages(group.userUuid, group.userUuid));
+    userList.appendChild(groupRow)
+}
+
 function fillUser(user, userList, hasChat) {
     const userRow = document.createElement('div');
     userRow.classList.add('row', 'chat-user');
@@ -88,26 +268,24 @@ function fillUser(user, userList, hasChat) {
     userRow.setAttribute("Lastname", user.user.lastName);
     userRow.setAttribute("Firstname", user.user.firstName);
     userRow.setAttribute("Gender", user.user.gender);
-    userRow.setAttribute("LastTimeOnline", formatDate(user.user.lastTimeOnline));
 
-    if (user.isOnline || hasChat) {
-        userRow.classList.add('clickable');
+    // Offline users can be messaged too, they get the backlog on their next connect
+    userRow.classList.add('clickable');
 
-        if (user.isOnline) {
-            userRow.setAttribute("LastTimeOnline", 'Now')
-            const status = document.createElement('span');
-            status.classList.add('chat-user-status');
-            status.textContent = "online";
-            userRow.appendChild(status)
-        }
+    setUserPresence(userRow, user.presence || (user.isOnline ? 'online' : 'offline'), user.user.lastTimeOnline);
 
-        userRow.addEventListener('click', () => {
-            let chatUUID = "";
-            if (user.chatUUID.Valid) chatUUID = user.chatUUID.String;
-            messagesAmount = 10;
-            showMessages(chatUUID, user.userUuid, messagesAmount)
-        });
+    if (hasChat && user.unreadCount > 0) {
+        const unread = document.createElement('span');
+        unread.classList.add('chat-user-unread');
+        unread.textContent = `${user.unreadCount} new`;
+        userRow.appendChild(unread)
     }
+
+    userRow.addEventListener('click', () => {
+        let chatUUID = "";
+        if (user.chatUUID.Valid) chatUUID = user.chatUUID.String;
+        showMessages(chatUUID, user.userUuid)
+    });
     const tooltip = document.getElementById("userTooltip");
     userRow.addEventListener("mouseover", (event) => {
         const age = userRow.getAttribute("age");
@@ -134,6 +312,36 @@ function fillUser(user, userList, hasChat) {
     userList.appendChild(userRow)
 }
 
+// setUserPresence shows online and idle users with a status label, offline ones with their last time online
+function setUserPresence(userRow, presence, lastTimeOnline) {
+    let status = userRow.querySelector('.chat-user-status');
+    if (presence == 'offline') {
+        userRow.setAttribute("LastTimeOnline", formatDate(lastTimeOnline));
+        if (status) status.remove();
+        return;
+    }
+
+    userRow.setAttribute("LastTimeOnline", 'Now');
+    if (!status) {
+        status = document.createElement('span');
+        status.classList.add('chat-user-status');
+        userRow.querySelector('.chat-user-name').after(status);
+    }
+    status.classList.toggle('chat-user-idle', presence == 'idle');
+    status.textContent = presence;
+}
+
+// updatePresence applies a presenceChanged event to the user's row
+export function updatePresence(msg) {
+    const userRow = document.getElementById('listedUser' + msg.userUuid);
+    if (!userRow) {
+        // A user we haven't listed yet, e.g. just registered
+        getUsersListing();
+        return;
+    }
+    setUserPresence(userRow, msg.status, msg.lastTimeOnline);
+}
+
 export function createUserList(msg) {
     const messages = document.getElementById('messaging-container');
 
@@ -146,14 +354,26 @@ export function createUserList(msg) {
         userList.innerHTML = '';
     }
 
+    const newGroup = document.createElement('button');
+    newGroup.classList.add('chat-new-group');
+    newGroup.textContent = "New group";
+    newGroup.addEventListener('click', createGroup);
+    userList.appendChild(newGroup)
+
     const acquaintances = document.createElement('span');
     acquaintances.classList.add('chat-small-title')
     acquaintances.textContent = "Existing chats";
     userList.appendChild(acquaintances)
 
+    listedUsers = [];
     if (msg.chattedUsers) {
         msg.chattedUsers.forEach(user => {
-            fillUser(user, userList, true)
+            if (user.isGroup) {
+                fillGroup(user, userList)
+            } else {
+                listedUsers.push(user);
+                fillUser(user, userList, true)
+            }
         });
     }
 
@@ -164,6 +384,7 @@ export function createUserList(msg) {
 
     if (msg.unchattedUsers) {
         msg.unchattedUsers.forEach(user => {
+            listedUsers.push(user);
             fillUser(user, userList, false)
         });
     }
@@ -183,7 +404,7 @@ function createChatBubble(m, chatMessages, append) {
     messageSender.textContent = m.message.sender_username;
     messageSender.classList.add('chat-bubble-sender');
     const messageContent = document.createElement('div');
-    messageContent.textContent = m.message.content;
+    messageContent.classList.add('chat-bubble-content');
     const timeAndDate = document.createElement('span');
     timeAndDate.classList.add('chat-bubble-time');
     timeAndDate.textContent = formatDate(m.message.created_at);
@@ -191,10 +412,35 @@ function createChatBubble(m, chatMessages, append) {
     chatBubble.appendChild(messageSender);
     chatBubble.appendChild(messageContent);
     chatBubble.appendChild(timeAndDate);
+    chatBubble.dataset.messageId = m.message.id;
 
     if (m.isCreatedBy) {
         chatBubble.classList.add('own-message');
+
+        const receipt = document.createElement('span');
+        receipt.classList.add('chat-bubble-receipt');
+        if (m.message.read_at) receipt.textContent = 'seen';
+        chatBubble.appendChild(receipt);
+
+        const actions = document.createElement('span');
+        actions.classList.add('chat-bubble-actions');
+        const editButton = document.createElement('button');
+        editButton.textContent = 'edit';
+        editButton.addEventListener('click', () => {
+            const messageContent = chatBubble.querySelector('.chat-bubble-content');
+            const content = prompt('Edit message', messageContent.dataset.source);
+            if (content && content.trim() !== '') editMessage(m.message.id, content, messageContent.dataset.format === 'markdown');
+        });
+        const deleteButton = document.createElement('button');
+        deleteButton.textContent = 'delete';
+        deleteButton.addEventListener('click', () => {
+            if (confirm('Delete this message?')) deleteMessage(m.message.id);
+        });
+        actions.appendChild(editButton);
+        actions.appendChild(deleteButton);
+        chatBubble.appendChild(actions);
     }
+    fillBubbleContent(chatBubble, m.message);
     if (!append) {
         chatMessages.prepend(chatBubble);
     } else {
@@ -202,7 +448,42 @@ function createChatBubble(m, chatMessages, append) {
     }
 }
 
+// Content, edited marker or tombstone of a bubble
+function fillBubbleContent(chatBubble, message) {
+    const messageContent = chatBubble.querySelector('.chat-bubble-content');
+    const actions = chatBubble.querySelector('.chat-bubble-actions');
+
+    if (message.status == 'delete') {
+        messageContent.textContent = 'message deleted';
+        chatBubble.classList.add('deleted-message');
+        if (actions) actions.remove();
+        return;
+    }
+
+    showRenderedText(messageContent, message.content, message.format, message.content_html);
+    if (message.updated_at) {
+        const edited = document.createElement('span');
+        edited.classList.add('chat-bubble-edited');
+        edited.textContent = ' (edited)';
+        messageContent.appendChild(edited);
+    }
+}
+
+// Add an older page above the messages already shown
+function addOlderMessages(msg, chatMessages) {
+    if (msg.privateMessages && Array.isArray(msg.privateMessages)) {
+        msg.privateMessages.forEach((m) => createChatBubble(m, chatMessages, true))
+        oldestMessageID = msg.privateMessages[msg.privateMessages.length - 1].message.id;
+    }
+    hasMoreMessages = msg.hasMore;
+}
+
 export function showChat(msg) {
+    const openChatMessages = document.getElementById(msg.reciverUserUUID);
+    if (msg.before > 0 && openChatMessages && openChatMessages.classList.contains('chat-bubbles')) {
+        addOlderMessages(msg, openChatMessages);
+        return;
+    }
 
     document.getElementById('forum-container').style.display = 'none';
     document.getElementById('profile-section').style.display = 'none';
@@ -231,40 +512,45 @@ export function showChat(msg) {
     chatTitle.classList.add('chat-title');
     chatTitle.textContent = 'Chat with ' + msg.receiverUserName;
 
+    // For groups the receiver is the chat itself
     let chatUuid = "";
+    if (msg.isGroup) {
+        chatUuid = msg.reciverUserUUID;
+        chatTitle.textContent = msg.receiverUserName;
+        chatTitle.appendChild(groupActions(msg.reciverUserUUID, msg.receiverUserName));
+        chatContainer.id = chatUuid;
+    }
     const chatMessages = document.createElement('div');
     chatMessages.classList.add('chat-bubbles');
     chatMessages.id = msg.reciverUserUUID; // id to find correct chat
 
 
+    oldestMessageID = 0;
     if (msg.privateMessages && Array.isArray(msg.privateMessages)) {
         chatUuid = msg.privateMessages[0].message.chat_uuid;
         msg.privateMessages.forEach((m) => createChatBubble(m, chatMessages, true))
+        oldestMessageID = msg.privateMessages[msg.privateMessages.length - 1].message.id;
     }
+    hasMoreMessages = msg.hasMore;
     chatTitle.classList.add('chat-messages');
 
-    // Add throttled loading of more messages if there are more
-    if (msg.allMessagesGot) {
-        let isThrottled = false;
-        chatMessages.addEventListener('scroll', event => {
-
-            if (isThrottled) return;
+    // Add throttled loading of older messages while there are more
+    let isThrottled = false;
+    chatMessages.addEventListener('scroll', event => {
 
-            isThrottled = true;
-            setTimeout(() => {
-                if (chatMessages.scrollTop * -1 >= chatMessages.scrollHeight - chatMessages.clientHeight - 1) {
-                    if (chatUuid != '') chatUuid = chatContainer.id;
-                    if (chatUuid != '') {
-                        messagesAmount += 10;
-                        previousScrollPosition = chatMessages.scrollTop;
+        if (isThrottled || !hasMoreMessages) return;
 
-                        showMessages(chatUuid, msg.reciverUserUUID, messagesAmount)
-                    }
+        isThrottled = true;
+        setTimeout(() => {
+            if (chatMessages.scrollTop * -1 >= chatMessages.scrollHeight - chatMessages.clientHeight - 1) {
+                if (chatUuid != '') chatUuid = chatContainer.id;
+                if (chatUuid != '' && hasMoreMessages) {
+                    showMessages(chatUuid, msg.reciverUserUUID, { before: oldestMessageID })
                 }
-                isThrottled = false;
-            }, 1000); // Throttle delay
-        });
-    }
+            }
+            isThrottled = false;
+        }, 1000); // Throttle delay
+    });
 
     const chatInput = document.createElement('div');
     chatInput.classList.add('chat-input');
@@ -273,25 +559,24 @@ export function showChat(msg) {
     chatTextInput.rows = '3';
     chatTextInput.value = typedInput;
 
-    //msg.uuid is this user, msg.reciverUserUUID is the other user
+    // The server knows who is typing, the chat is found by UUID or, before the
+    // client has seen one, by the other user of the direct chat
     chatTextInput.addEventListener("input", () => {
-        if (chatTextInput.value.trim() === "") {
-            ws.send(JSON.stringify({ type: "stopped_typing", from: msg.uuid, to: msg.reciverUserUUID }));
-        } else {
-            ws.send(JSON.stringify({ type: "typing", from: msg.uuid, to: msg.reciverUserUUID }));
-        }
+        const type = chatTextInput.value.trim() === "" ? "stopped_typing" : "typing";
+        ws.send(JSON.stringify({ type, chatUUID: chatUuid || chatContainer.id, to: msg.reciverUserUUID }));
     });
 
-    if (currentChatUUID !== chatUuid) {
+    if (currentChatUUID !== chatUuid || previousReceiver !== msg.reciverUserUUID) {
         if (previousReceiver) {
-            ws.send(JSON.stringify({ type: "stopped_typing", from: msg.uuid, to: previousReceiver }));
+            ws.send(JSON.stringify({ type: "stopped_typing", chatUUID: currentChatUUID, to: previousReceiver }));
         }
         currentChatUUID = chatUuid;
         previousReceiver = msg.reciverUserUUID;
-        thisUser = msg.uuid;
     }
 
     chatInput.appendChild(chatTextInput);
+    const markdownToggle = createMarkdownToggle();
+    chatInput.appendChild(markdownToggle);
     const chatSendButton = document.createElement('button');
     chatSendButton.textContent = "Send";
 
@@ -299,7 +584,7 @@ export function showChat(msg) {
         const receiverUUID = msg.reciverUserUUID;
         const messageText = chatTextInput.value.trim();
         if (messageText != '') {
-            sendMessage(receiverUUID, chatUuid, chatTextInput.value.trim());
+            sendMessage(receiverUUID, chatUuid, chatTextInput.value.trim(), markdownToggle.querySelector('input').checked);
             chatTextInput.value = '';
         }
     });
@@ -308,12 +593,61 @@ export function showChat(msg) {
     chatContainer.appendChild(chatTitle);
     chatContainer.appendChild(chatMessages);
     chatContainer.appendChild(chatInput);
-
-    chatMessages.scrollTop = previousScrollPosition;
 }
 
 export function addMessageToChat(msg) {
     let chatMessages = document.getElementById(msg.reciverUserUUID);
     if (!chatMessages) chatMessages = document.getElementById(msg.uuid);
-    if (chatMessages) createChatBubble(msg.privateMessage, chatMessages, false)
-}
\ No newline at end of file
+    if (chatMessages) {
+        createChatBubble(msg.privateMessage, chatMessages, false)
+
+        // The chat is open, so a received message is seen right away
+        if (!msg.privateMessage.isCreatedBy) markRead(msg.privateMessage.message.chat_uuid);
+    }
+}
+
+export function showReadReceipt(msg) {
+    const chatContainer = document.querySelector('.chat-container');
+    if (!chatContainer || chatContainer.id !== msg.privateMessage.message.chat_uuid) return;
+
+    chatContainer.querySelectorAll('.own-message').forEach(bubble => {
+        if (Number(bubble.dataset.messageId) <= msg.privateMessage.message.id) {
+            bubble.querySelector('.chat-bubble-receipt').textContent = 'seen';
+        }
+    });
+}
+
+// Apply an edit or delete to the bubble if its chat is open
+export function updateChatBubble(msg) {
+    const chatContainer = document.querySelector('.chat-container');
+    if (!chatContainer || chatContainer.id !== msg.privateMessage.message.chat_uuid) return;
+
+    const bubble = chatContainer.querySelector(`[data-message-id="${msg.privateMessage.message.id}"]`);
+    if (bubble) fillBubbleContent(bubble, msg.privateMessage.message);
+}
+
+function groupActions(ChatUUID, name) {
+    const actions = document.createElement('span');
+    actions.classList.add('chat-group-actions');
+    [['rename', () => renameGroup(ChatUUID, name)],
+    ['add member', () => addGroupMembers(ChatUUID)],
+    ['leave', () => leaveGroup(ChatUUID)]].forEach(([label, action]) => {
+        const button = document.createElement('button');
+        button.textContent = label;
+        button.addEventListener('click', action);
+        actions.appendChild(button);
+    });
+    return actions;
+}
+
+// A group was created, renamed or its members changed
+export function updateGroupChat(msg) {
+    getUsersListing();
+
+    const chatContainer = document.querySelector('.chat-container');
+    if (!chatContainer || chatContainer.id !== msg.privateMessage.message.chat_uuid) return;
+
+    const chatTitle = chatContainer.querySelector('.chat-title');
+    chatTitle.textContent = msg.receiverUserName;
+    chatTitle.appendChild(groupActions(msg.privateMessage.message.chat_uuid, msg.receiverUserName));
+}
@@ -1,5 +1,107 @@
-import { handleDislike, handleLike, openAndSendReply, openReplies } from "./posts.js";
-import { feed } from "./realtime.js";
+import { deletePost, deleteReply, editReply, handleDislike, handleLike, openAndSendReply, openReplies, updatePost } from "./posts.js";
+import { currentUser, feed, logout } from "./realtime.js";
+
+// Shows the sanitized HTML the server rendered, the source and format are kept for editing
+export function showRenderedText(element, source, format, html) {
+    element.innerHTML = html;
+    element.dataset.source = source;
+    element.dataset.format = format;
+}
+
+// Checkbox to opt in to Markdown formatting of a new text
+export function createMarkdownToggle() {
+    const label = document.createElement('label');
+    label.classList.add('markdown-toggle');
+    const checkbox = document.createElement('input');
+    checkbox.type = 'checkbox';
+    label.appendChild(checkbox);
+    label.appendChild(document.createTextNode(' Markdown'));
+    return label;
+}
+
+// Marker of edited posts and replies, clicking it shows what the edits changed
+function createEditedMarker(item, query, contentElement) {
+    const marker = document.createElement('span');
+    marker.classList.add('post-edited', 'clickable');
+    marker.title = 'Show changes';
+    marker.addEventListener('click', () => toggleRevisions(query, contentElement));
+    setEditedMarker(marker, item);
+    return marker;
+}
+
+function setEditedMarker(marker, item) {
+    if (!marker) return;
+    marker.textContent = item.revisions == 1 ? 'edited once' : `edited ${item.revisions} times`;
+    marker.style.display = item.edited ? '' : 'none';
+}
+
+// Opens the revisions below the content, with the changes between two of them, or closes them
+function toggleRevisions(query, contentElement) {
+    const open = contentElement.nextElementSibling;
+    if (open && open.classList.contains('revisions')) {
+        open.remove();
+        return;
+    }
+
+    fetch(`/api/revisions?${query}`)
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error reading revisions")
+                }
+                return;
+            }
+
+            const panel = document.createElement('div');
+            panel.classList.add('revisions');
+            const row = document.createElement('div');
+            row.classList.add('row');
+            const from = document.createElement('select');
+            const to = document.createElement('select');
+            data.revisions.forEach(revision => {
+                const label = `#${revision.number} ${revision.user.username} ${formatDate(revision.created_at)}` + (revision.current ? ' (current)' : '');
+                from.appendChild(new Option(label, revision.number));
+                to.appendChild(new Option(label, revision.number));
+            });
+            from.value = Math.max(data.revisions.length - 1, 1);
+            to.value = data.revisions.length;
+            const diff = document.createElement('pre');
+            diff.classList.add('revision-diff');
+            const showDiff = () => showRevisionDiff(diff, query, from.value, to.value);
+            from.addEventListener('change', showDiff);
+            to.addEventListener('change', showDiff);
+
+            row.appendChild(from);
+            row.appendChild(document.createTextNode('→'));
+            row.appendChild(to);
+            panel.appendChild(row);
+            panel.appendChild(diff);
+            contentElement.after(panel);
+            showDiff();
+        });
+}
+
+function showRevisionDiff(element, query, from, to) {
+    fetch(`/api/revisions/diff?${query}&from=${from}&to=${to}`)
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            element.innerHTML = '';
+            if (!data.success) {
+                console.log("error reading revision diff")
+                return;
+            }
+            const prefixes = { insert: '+ ', delete: '- ', equal: '  ' };
+            [...(data.title || []), ...data.lines].forEach(line => {
+                const span = document.createElement('span');
+                span.classList.add(`diff-${line.op}`);
+                span.textContent = prefixes[line.op] + line.text + '\n';
+                element.appendChild(span);
+            });
+        });
+}
 
 export function formatDate(isoString) {
     const date = new Date(isoString);
@@ -18,8 +120,8 @@ export function formatDate(isoString) {
     return new Intl.DateTimeFormat("fi-FI", options).format(date).replace("klo ","");
 }
 
-// Function to add a post to the page
-export function addPostToFeed(post) {
+// Function to add a post to the page, new posts go on top and pages of older ones below
+export function addPostToFeed(post, append = false) {
     const newPost = document.createElement('div');
     newPost.className = 'post';
     const formattedID = `postid${post.id}`;
@@ -62,14 +164,14 @@ export function addPostToFeed(post) {
     addReplyText.classList.add('post-addreply');
     repliesInfo.classList.add('post-replies');
     repliesInfo.id = `post-${post.id}`
-    rowBottom.classList.add('row');
+    rowBottom.classList.add('row', 'post-bottom');
     addReplyDiv.classList.add('add-reply');
     replyDiv.classList.add('replies');
 
     title.textContent = post.title;
     author.textContent = post.user.username;
     date.textContent = formatDate(post.created_at);
-    content.textContent = post.description;
+    showRenderedText(content, post.description, post.format, post.description_html);
     likesThumb.textContent = "thumb_up";
     likesText.textContent = post.number_of_likes;
     dislikesThumb.textContent = "thumb_down";
@@ -90,9 +192,20 @@ export function addPostToFeed(post) {
         repliesInfo.addEventListener("click", () => openReplies(post.id, "post", formattedID, replyDiv));
     }
 
+    const permalink = document.createElement('a');
+    permalink.classList.add('material-symbols-outlined', 'post-permalink');
+    permalink.href = `#post/${post.uuid}`;
+    permalink.title = 'Open thread';
+    permalink.textContent = 'link';
+
     rowTitle.appendChild(title);
+    rowTitle.appendChild(permalink);
     rowAuthorDate.appendChild(author);
     rowAuthorDate.appendChild(date);
+    rowAuthorDate.appendChild(createEditedMarker(post, `uuid=${post.uuid}`, content));
+    if (post.user.username === currentUser.username || currentUser.isAdmin) {
+        rowAuthorDate.appendChild(createPostActions(newPost, post));
+    }
     postItems.appendChild(rowAuthorDate);
     postItems.appendChild(rowTitle);
     postItems.appendChild(content);
@@ -106,12 +219,7 @@ export function addPostToFeed(post) {
     rowBottom.appendChild(rowAddRepy);
     rowBottom.appendChild(repliesInfo);
 
-    post.categories.forEach(cat => {
-        const category = document.createElement('span');
-        category.classList.add('post-categories');
-        category.textContent = cat.name;
-        rowBottom.appendChild(category);
-    });
+    addPostCategories(rowBottom, post.categories);
 
     postItems.appendChild(rowBottom);
     postItems.appendChild(addReplyDiv);
@@ -130,7 +238,71 @@ export function addPostToFeed(post) {
         if (existingReplyInput) existingReplyInput.remove();
     })
 
-    feed.prepend(newPost);
+    if (append) {
+        feed.appendChild(newPost);
+    } else {
+        feed.prepend(newPost);
+    }
+}
+
+function addPostCategories(rowBottom, categories) {
+    categories.forEach(cat => {
+        const category = document.createElement('span');
+        category.classList.add('post-categories');
+        category.textContent = cat.name;
+        rowBottom.appendChild(category);
+    });
+}
+
+// Edit and delete buttons, the post element keeps the current values for editing
+function createPostActions(postElement, post) {
+    postElement.dataset.uuid = post.uuid;
+    postElement.dataset.categoryIds = JSON.stringify(post.categories.map(cat => cat.id));
+
+    const actions = document.createElement('span');
+    actions.classList.add('post-actions');
+    const editButton = document.createElement('button');
+    editButton.textContent = 'edit';
+    editButton.addEventListener('click', () => {
+        const title = prompt('Edit title', postElement.querySelector('.post-title').textContent);
+        if (!title || title.trim() === '') return;
+        const contentElement = postElement.querySelector('.post-content');
+        const content = prompt('Edit content', contentElement.dataset.source);
+        if (!content || content.trim() === '') return;
+        updatePost(postElement.dataset.uuid, title, content, JSON.parse(postElement.dataset.categoryIds), contentElement.dataset.format === 'markdown');
+    });
+    const deleteButton = document.createElement('button');
+    deleteButton.textContent = 'delete';
+    deleteButton.addEventListener('click', () => {
+        if (confirm('Delete this post?')) deletePost(postElement.dataset.uuid);
+    });
+    actions.appendChild(editButton);
+    actions.appendChild(deleteButton);
+    return actions;
+}
+
+// Apply an edit made by anyone to the post in the feed
+export function updatePostInFeed(post) {
+    const postElement = document.getElementById(`postid${post.id}`);
+    if (!postElement) return;
+
+    postElement.querySelector('.post-title').textContent = post.title;
+    const content = postElement.querySelector('.post-content');
+    showRenderedText(content, post.description, post.format, post.description_html);
+    setEditedMarker(postElement.querySelector(':scope > .post-items .post-edited'), post);
+    if (content.nextElementSibling && content.nextElementSibling.classList.contains('revisions')) content.nextElementSibling.remove();
+    if (postElement.dataset.categoryIds) {
+        postElement.dataset.categoryIds = JSON.stringify(post.categories.map(cat => cat.id));
+    }
+
+    const rowBottom = postElement.querySelector('.post-bottom');
+    rowBottom.querySelectorAll('.post-categories').forEach(cat => cat.remove());
+    addPostCategories(rowBottom, post.categories);
+}
+
+export function removePostFromFeed(post) {
+    const postElement = document.getElementById(`postid${post.id}`);
+    if (postElement) postElement.remove();
 }
 
 export function addReplyToParent(parentFormattedID, comment, numberOfRepliesForParent) {
@@ -203,7 +375,7 @@ export function addReplyToParent(parentFormattedID, comment, numberOfRepliesForP
 
     author.textContent = comment.user.username;
     date.textContent = formatDate(comment.created_at);
-    content.textContent = comment.description;
+    showRenderedText(content, comment.description, comment.format, comment.description_html);
     likesThumb.textContent = "thumb_up";
     likesText.textContent = comment.number_of_likes;
     dislikesThumb.textContent = "thumb_down";
@@ -226,6 +398,10 @@ export function addReplyToParent(parentFormattedID, comment, numberOfRepliesForP
 
     rowAuthorDate.appendChild(author);
     rowAuthorDate.appendChild(date);
+    rowAuthorDate.appendChild(createEditedMarker(comment, `commentID=${comment.id}`, content));
+    if (comment.status != 'delete' && (comment.user.username === currentUser.username || currentUser.isAdmin)) {
+        rowAuthorDate.appendChild(createReplyActions(newReply, comment));
+    }
     replyItems.appendChild(rowAuthorDate);
     replyItems.appendChild(rowTitle);
     replyItems.appendChild(content);
@@ -244,6 +420,71 @@ export function addReplyToParent(parentFormattedID, comment, numberOfRepliesForP
     newReply.appendChild(replyItems);
     newReply.appendChild(replyDiv);
 
+    if (comment.status == 'delete') markReplyDeleted(newReply);
+
     const replyDivs = parent.querySelector(".replies")
     replyDivs.prepend(newReply);
+}
+
+function createReplyActions(replyElement, comment) {
+    const actions = document.createElement('span');
+    actions.classList.add('post-actions');
+    const editButton = document.createElement('button');
+    editButton.textContent = 'edit';
+    editButton.addEventListener('click', () => {
+        const contentElement = replyElement.querySelector('.post-content');
+        const content = prompt('Edit reply', contentElement.dataset.source);
+        if (content && content.trim() !== '') editReply(comment.id, content, contentElement.dataset.format === 'markdown');
+    });
+    const deleteButton = document.createElement('button');
+    deleteButton.textContent = 'delete';
+    deleteButton.addEventListener('click', () => {
+        if (confirm('Delete this reply?')) deleteReply(comment.id);
+    });
+    actions.appendChild(editButton);
+    actions.appendChild(deleteButton);
+    return actions;
+}
+
+// A deleted reply keeps its place in the thread when it has replies of its own
+function markReplyDeleted(replyElement) {
+    replyElement.classList.add('deleted-reply');
+    replyElement.querySelector('.post-author').textContent = '[deleted]';
+    replyElement.querySelector('.post-content').textContent = '[deleted]';
+    const actions = replyElement.querySelector('.post-actions');
+    if (actions) actions.remove();
+    const reactions = replyElement.querySelector('.post-reactions');
+    if (reactions) reactions.remove();
+    const addReply = replyElement.querySelector('.post-addition');
+    if (addReply) addReply.remove();
+    const edited = replyElement.querySelector('.post-edited');
+    if (edited) edited.remove();
+    const revisions = replyElement.querySelector(':scope > .reply-items .revisions');
+    if (revisions) revisions.remove();
+}
+
+export function updateReplyInFeed(comment) {
+    const replyElement = document.getElementById(`replyid${comment.id}`);
+    if (!replyElement) return;
+
+    const content = replyElement.querySelector('.post-content');
+    showRenderedText(content, comment.description, comment.format, comment.description_html);
+    setEditedMarker(replyElement.querySelector(':scope > .reply-items .post-edited'), comment);
+    if (content.nextElementSibling && content.nextElementSibling.classList.contains('revisions')) content.nextElementSibling.remove();
+}
+
+export function removeReplyFromFeed(comment, numberOfRepliesForParent) {
+    const replyElement = document.getElementById(`replyid${comment.id}`);
+    if (replyElement) {
+        if (comment.repliesCount > 0) {
+            markReplyDeleted(replyElement);
+        } else {
+            replyElement.remove();
+        }
+    }
+
+    const parentCount = comment.post_id !== 0
+        ? document.getElementById(`post-${comment.post_id}`)
+        : document.getElementById(`comment-${comment.comment_id}`);
+    if (parentCount) parentCount.textContent = numberOfRepliesForParent + " replies";
 }
\ No newline at end of file
@@ -1,17 +1,33 @@
 import { addReplyToParent } from "./createposts.js";
-import { addPostToFeed } from "./createposts.js";
-import { feed, toggleInput, logout } from "./realtime.js";
+import { addPostToFeed, createMarkdownToggle, formatDate } from "./createposts.js";
+import { errorText, feed, toggleInput, logout } from "./realtime.js";
 
-// Fetch initial posts
-export function fetchPosts(categoryId) {
-    feed.innerHTML = "";
-    fetch(`/api/posts?categoryid=${categoryId}`)
+// Feed state, pages continue after the last post shown
+let feedCategoryId = 0;
+let feedSort = 'newest';
+let lastPostID = 0;
+
+// Fetch the first page of posts, or the next one when more is set
+export function fetchPosts(categoryId, more = false) {
+    const loadMoreButton = document.getElementById('load-more-posts');
+    if (!more) {
+        feed.innerHTML = "";
+        feedCategoryId = categoryId;
+        lastPostID = 0;
+        searchQuery = '';
+        if (location.hash) history.replaceState(null, '', location.pathname); // leaving a thread
+    }
+    loadMoreButton.style.display = 'none';
+
+    fetch(`/api/posts?categoryid=${feedCategoryId}&sort=${feedSort}&before=${lastPostID}`)
         .then(res => res.json().then(data => ({ success: res.ok, ...data }))) // Merge res.ok into data
         .then(data => {
             if (data.success) {
                 if (data.posts && Array.isArray(data.posts)) {
-                    data.posts.forEach(addPostToFeed);
+                    data.posts.forEach(post => addPostToFeed(post, true));
+                    if (data.posts.length > 0) lastPostID = data.posts[data.posts.length - 1].id;
                 }
+                if (data.hasMore) loadMoreButton.style.display = 'block';
             } else {
                 document.getElementById('errorMessageLogin').textContent = data.message || "Not logged in.";
                 if (data.message && data.message == "Not logged in") {
@@ -21,20 +37,156 @@ export function fetchPosts(categoryId) {
         });
 }
 
-export function openReplies(parentID, parentType, formattedID, repliesDiv) {
-    const replies = repliesDiv.querySelectorAll(".reply");
+// Show one post with its whole reply tree, opened from a #post/<uuid> link
+export function showThread(postUUID) {
+    fetch(`/api/posts/${postUUID}`)
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                document.getElementById('errorMessageLogin').textContent = data.message || "Not logged in.";
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error opening thread")
+                }
+                return;
+            }
+
+            feed.innerHTML = "";
+            document.getElementById('load-more-posts').style.display = 'none';
+            addPostToFeed(data.post);
+
+            const postElement = document.getElementById(`postid${data.post.id}`);
+            postElement.querySelector('.post-content').style.display = 'block';
+            postElement.querySelector('.post-bottom').style.display = 'flex';
+            postElement.querySelector('.replies').style.display = 'block';
+            addReplyTree(postElement.id, data.comments || []);
+        });
+}
+
+function addReplyTree(parentFormattedID, comments) {
+    comments.forEach(comment => {
+        const formattedID = `replyid${comment.id}`;
+        addReplyToParent(parentFormattedID, comment);
+        addReplyTree(formattedID, comment.replies || []);
+        if (comment.moreReplies > 0) {
+            const replies = comment.replies || [];
+            const after = replies.length > 0 ? replies[replies.length - 1].id : 0;
+            const repliesDiv = document.getElementById(formattedID).querySelector('.replies');
+            addMoreReplies(comment.id, "comment", formattedID, repliesDiv, comment.moreReplies, after);
+        }
+    });
+}
+
+// Replies cut by the depth or page size are loaded from a "N more replies" marker
+function addMoreReplies(parentID, parentType, formattedID, repliesDiv, count, after) {
+    const marker = document.createElement('span');
+    marker.classList.add('more-replies', 'clickable');
+    marker.textContent = count == 1 ? "1 more reply" : `${count} more replies`;
+    marker.addEventListener("click", () => {
+        marker.remove();
+        openReplies(parentID, parentType, formattedID, repliesDiv, after);
+    });
+    repliesDiv.prepend(marker);
+}
+
+export function fetchMorePosts() {
+    if (searchQuery) {
+        searchPosts(true);
+        return;
+    }
+    fetchPosts(feedCategoryId, true);
+}
+
+let searchQuery = '';
+let searchPage = 1;
+
+// Search replaces the feed with results until a category is picked again
+export function searchPosts(more = false) {
+    const loadMoreButton = document.getElementById('load-more-posts');
+    if (!more) {
+        searchQuery = document.getElementById('search-input').value.trim();
+        searchPage = 1;
+        if (!searchQuery) {
+            fetchPosts(feedCategoryId);
+            return;
+        }
+        feed.innerHTML = "";
+    } else {
+        searchPage++;
+    }
+    loadMoreButton.style.display = 'none';
+
+    fetch(`/api/search?q=${encodeURIComponent(searchQuery)}&page=${searchPage}`)
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (data.success) {
+                (data.results || []).forEach(addSearchResult);
+                if (!more && !data.results) feed.textContent = 'No results';
+                if (data.hasMore) loadMoreButton.style.display = 'block';
+            } else if (data.message && data.message == "Not logged in") {
+                logout();
+            } else {
+                console.log("error searching")
+            }
+        });
+}
+
+function addSearchResult(result) {
+    const item = document.createElement('div');
+    item.classList.add('post', 'search-result');
 
-    if (replies.length != 0) {
+    const title = document.createElement('div');
+    title.classList.add('post-title');
+    title.textContent = result.postTitle;
+
+    const info = document.createElement('div');
+    info.classList.add('row');
+    const author = document.createElement('span');
+    author.classList.add('post-author');
+    author.textContent = (result.kind == 'comment' ? 'Reply by ' : 'Post by ') + result.author;
+    const date = document.createElement('span');
+    date.classList.add('post-date');
+    date.textContent = formatDate(result.createdAt);
+    info.appendChild(author);
+    info.appendChild(date);
+
+    // The server escapes the snippet and only adds <mark> tags
+    const snippet = document.createElement('div');
+    snippet.classList.add('post-content');
+    snippet.innerHTML = result.snippet;
+
+    item.appendChild(info);
+    item.appendChild(title);
+    item.appendChild(snippet);
+    feed.appendChild(item);
+}
+
+export function changeSort(event) {
+    feedSort = event.target.value;
+    fetchPosts(feedCategoryId);
+}
+
+// Opens the reply tree of a post or comment, or closes it when it's open.
+// After continues the direct replies behind the last one shown
+export function openReplies(parentID, parentType, formattedID, repliesDiv, after = 0) {
+    const replies = repliesDiv.querySelectorAll(".reply, .more-replies");
+
+    if (after == 0 && replies.length != 0) {
         replies.forEach(reply => reply.remove())
         return;
     }
 
-    fetch(`/api/replies?parentID=${parentID}&parentType=${parentType}`)
+    fetch(`/api/replies?parentID=${parentID}&parentType=${parentType}&after=${after}`)
         .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
         .then(data => {
             if (data.success) {
                 if (data.comments && Array.isArray(data.comments)) {
-                    data.comments.forEach(comment => addReplyToParent(formattedID, comment));
+                    addReplyTree(formattedID, data.comments);
+                    if (data.moreReplies > 0) {
+                        const last = data.comments[data.comments.length - 1].id;
+                        addMoreReplies(parentID, parentType, formattedID, repliesDiv, data.moreReplies, last);
+                    }
                 }
             } else {
                 document.getElementById('errorMessageLogin').textContent = data.message || "Not logged in.";
@@ -114,8 +266,11 @@ export function openAndSendReply(formattedID, parentID, parentType) {
     submitButton.textContent = 'Reply';
     submitButton.classList.add('reply-button');
 
+    const markdownToggle = createMarkdownToggle();
+
     // Append input and button to container
     replyContainer.appendChild(replyInput);
+    replyContainer.appendChild(markdownToggle);
     replyContainer.appendChild(submitButton);
 
     const addReplyDiv = parent.querySelector(".add-reply")
@@ -129,7 +284,7 @@ export function openAndSendReply(formattedID, parentID, parentType) {
         fetch(`/api/addreply?parentType=${parentType}`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ content, parentid: parentID })
+            body: JSON.stringify({ content, markdown: markdownToggle.querySelector('input').checked, parentid: parentID })
         })
             .then(res => res.json())
             .then(data => {
@@ -148,6 +303,71 @@ export function openAndSendReply(formattedID, parentID, parentType) {
     });
 }
 
+// Edit a post, the author and admins get the edit and delete buttons
+export function updatePost(postUUID, title, content, categoryIds, markdown) {
+    fetch(`/api/posts?uuid=${postUUID}`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ title, content, markdown, categoryIds })
+    })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error editing post")
+                }
+            }
+        });
+}
+
+export function deletePost(postUUID) {
+    fetch(`/api/posts?uuid=${postUUID}`, { method: 'DELETE' })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error deleting post")
+                }
+            }
+        });
+}
+
+export function editReply(commentID, content, markdown) {
+    fetch(`/api/editreply?commentID=${commentID}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ content, markdown })
+    })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error editing reply")
+                }
+            }
+        });
+}
+
+export function deleteReply(commentID) {
+    fetch(`/api/deletereply?commentID=${commentID}`, { method: 'POST' })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error deleting reply")
+                }
+            }
+        });
+}
+
 let categories = []; // selected categories
 let categoryIds = [];
 
@@ -155,6 +375,7 @@ let categoryIds = [];
 export async function sendPost() {
     const titleInput = document.getElementById('postTitle');
     const contentInput = document.getElementById('postInput');
+    const markdown = document.getElementById('postMarkdown').checked;
     const errorMessage = document.getElementById('errorMessageFeed');
 
     const title = titleInput.value.trim();
@@ -169,33 +390,168 @@ export async function sendPost() {
     errorMessage.textContent = '';
     errorMessage.style.display = 'none';
 
-    await fetch('/api/posts', {
+    // Scheduled posts and resumed drafts are published through the drafts
+    if (document.getElementById('postPublishAt').value || draftUUID) {
+        const draft = await saveDraft();
+        if (!draft || draft.publish_at) return;
+        const published = await fetch(`/api/drafts/publish?uuid=${draft.uuid}`, { method: 'POST' })
+            .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))); // Prevent JSON parse errors
+        if (!published.success) console.log("error publishing draft")
+        return;
+    }
+
+    const data = await fetch('/api/posts', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ title, content, categoryIds })
+        body: JSON.stringify({ title, content, markdown, categoryIds })
     })
-        .then(res => res.json())
+        .then(res => res.json());
+
+    if (data.errors) {
+        // Keep the input so the user can fix the rejected fields
+        errorMessage.style.display = 'block';
+        errorMessage.textContent = errorText(data, "Invalid post");
+        return;
+    }
+    if (!data.success) {
+        document.getElementById('errorMessageLogin').textContent = data.message || "Not logged in";
+        if (data.message && data.message == "Not logged in") {
+            console.log(data.message);
+            logout();
+        } else {
+            console.log("error getting posts")
+        }
+    }
+
+    clearPostInput();
+}
+
+function clearPostInput() {
+    document.getElementById('postTitle').value = '';
+    document.getElementById('postInput').value = '';
+    document.getElementById('postMarkdown').checked = false;
+    document.getElementById('postPublishAt').value = '';
+    categories = [];
+    categoryIds = [];
+    draftUUID = '';
+    document.getElementById('categories').innerHTML = '';
+    toggleInput();
+}
+
+// The draft resumed in the post input, saving it again updates that draft
+let draftUUID = '';
+
+// Save the post input as a draft, without a publish time it waits to be resumed.
+// Returns the saved draft, or nothing when saving failed
+export async function saveDraft() {
+    const errorMessage = document.getElementById('errorMessageFeed');
+    const publishAt = document.getElementById('postPublishAt').value;
+    const draft = {
+        title: document.getElementById('postTitle').value.trim(),
+        content: document.getElementById('postInput').value.trim(),
+        markdown: document.getElementById('postMarkdown').checked,
+        categoryIds,
+        publishAt: publishAt ? new Date(publishAt).toISOString() : null,
+    };
+
+    const data = await fetch(draftUUID ? `/api/drafts?uuid=${draftUUID}` : '/api/drafts', {
+        method: draftUUID ? 'PUT' : 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(draft)
+    })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))); // Prevent JSON parse errors
+
+    if (!data.success) {
+        if (data.message && data.message == "Not logged in") {
+            logout();
+            return;
+        }
+        errorMessage.style.display = 'block';
+        errorMessage.textContent = errorText(data, "Saving the draft failed");
+        return;
+    }
+
+    errorMessage.textContent = '';
+    errorMessage.style.display = 'none';
+    clearPostInput();
+    return data.draft;
+}
+
+// List the user's drafts under the post input
+export function loadDrafts() {
+    fetch('/api/drafts')
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
         .then(data => {
             if (!data.success) {
-                document.getElementById('errorMessageLogin').textContent = data.message || "Not logged in";
                 if (data.message && data.message == "Not logged in") {
-                    console.log(data.message);
                     logout();
                 } else {
-                    console.log("error getting posts")
+                    console.log("error getting drafts")
                 }
+                return;
             }
-        });
 
+            const list = document.getElementById('drafts-list');
+            list.innerHTML = '';
+            (data.drafts || []).forEach(draft => {
+                const row = document.createElement('div');
+                row.classList.add('row', 'draft');
+                const title = document.createElement('span');
+                title.classList.add('draft-title');
+                title.textContent = draft.title || 'Untitled draft';
+                const when = document.createElement('span');
+                when.classList.add('post-date');
+                when.textContent = draft.publish_at ? 'publishes ' + formatDate(draft.publish_at) : 'draft';
+                const resumeButton = document.createElement('button');
+                resumeButton.textContent = 'resume';
+                resumeButton.addEventListener('click', () => resumeDraft(draft));
+                const discardButton = document.createElement('button');
+                discardButton.textContent = 'discard';
+                discardButton.addEventListener('click', () => {
+                    if (confirm('Discard this draft?')) discardDraft(draft.uuid);
+                });
+                row.appendChild(title);
+                row.appendChild(when);
+                row.appendChild(resumeButton);
+                row.appendChild(discardButton);
+                list.appendChild(row);
+            });
+        });
+}
 
+function resumeDraft(draft) {
+    draftUUID = draft.uuid;
+    document.getElementById('postTitle').value = draft.title;
+    document.getElementById('postInput').value = draft.description;
+    document.getElementById('postMarkdown').checked = draft.format === 'markdown';
+    // datetime-local takes the local time without a zone
+    let publishAt = '';
+    if (draft.publish_at) {
+        const date = new Date(draft.publish_at);
+        date.setMinutes(date.getMinutes() - date.getTimezoneOffset());
+        publishAt = date.toISOString().slice(0, 16);
+    }
+    document.getElementById('postPublishAt').value = publishAt;
+    categories = (draft.categories || []).map(category => category.name);
+    categoryIds = (draft.categories || []).map(category => category.id);
+    renderCategories();
+}
 
-    // Clear input fields
-    titleInput.value = '';
-    contentInput.value = '';
-    categories = [];
-    categoryIds = [];
-    document.getElementById('categories').innerHTML = '';
-    toggleInput();
+function discardDraft(uuid) {
+    fetch(`/api/drafts?uuid=${uuid}`, { method: 'DELETE' })
+        .then(res => res.json().catch(() => ({ success: false, message: "Invalid JSON response" }))) // Prevent JSON parse errors
+        .then(data => {
+            if (!data.success) {
+                if (data.message && data.message == "Not logged in") {
+                    logout();
+                } else {
+                    console.log("error discarding draft")
+                }
+                return;
+            }
+            if (draftUUID == uuid) draftUUID = '';
+            loadDrafts();
+        });
 }
 
 export function updateCategory() {
@@ -1,13 +1,14 @@
-import { fetchPosts, removeLastCategory, sendPost, updateCategory } from "./posts.js";
-import { addPostToFeed, addReplyToParent } from "./createposts.js";
-import { addMessageToChat, createUserList, getUsersListing, previousReceiver, showChat, thisUser } from "./chats.js";
+import { changeSort, fetchMorePosts, fetchPosts, loadDrafts, removeLastCategory, saveDraft, searchPosts, sendPost, showThread, updateCategory } from "./posts.js";
+import { addPostToFeed, addReplyToParent, removePostFromFeed, removeReplyFromFeed, updatePostInFeed, updateReplyInFeed } from "./createposts.js";
+import { addMessageToChat, createUserList, getUsersListing, currentChatUUID, handleRequestReply, previousReceiver, showChat, showReadReceipt, updateChatBubble, updateGroupChat, updatePresence } from "./chats.js";
 
 export const feed = document.getElementById('posts-feed');
 export let ws;
+export const currentUser = { username: '', isAdmin: false };
 
 function chatMessages(msg) {
     if (msg.msgType == "listOfChat") createUserList(msg);
-    if (msg.msgType == "updateClients") getUsersListing();
+    if (msg.msgType == "presenceChanged") updatePresence(msg);
 
     if (msg.msgType == "sendMessage") {
         getUsersListing();
@@ -21,9 +22,49 @@ function chatMessages(msg) {
     if (msg.msgType == "showMessages") {
         showChat(msg);
     }
+
+    // Sent to the sender of the messages and to the reader's other tabs
+    if (msg.msgType == "readReceipt") {
+        getUsersListing();
+        showReadReceipt(msg);
+    }
+
+    // Sent to both participants of the chat
+    if (msg.msgType == "messageEdited" || msg.msgType == "messageDeleted") {
+        updateChatBubble(msg);
+        if (msg.msgType == "messageDeleted") getUsersListing();
+    }
+
+    if (msg.msgType == "chatUpdated") {
+        updateGroupChat(msg);
+    }
+
+    // Messages that arrived while this user was offline
+    if (msg.msgType == "messageBacklog" && msg.privateMessages) {
+        const senders = [...new Set(msg.privateMessages.map(m => m.message.sender_username))];
+        showNotification(senders.join(', '));
+        getUsersListing();
+    }
 }
 
 function forumMessages(msg) {
+    if (msg.msgType === "postUpdated") {
+        updatePostInFeed(msg.post);
+        return;
+    }
+    if (msg.msgType === "postDeleted") {
+        removePostFromFeed(msg.post);
+        return;
+    }
+    if (msg.msgType === "commentUpdated") {
+        updateReplyInFeed(msg.comment);
+        return;
+    }
+    if (msg.msgType === "commentDeleted") {
+        removeReplyFromFeed(msg.comment, msg.numberOfReplies);
+        return;
+    }
+
     let postToModify;
     let replyToModify;
 
@@ -77,7 +118,9 @@ function forumMessages(msg) {
 const typingTimers = new Map();
 
 function typingMessages(msg) {
-    const userOnList = document.getElementById('listedUser' + msg.userFrom)
+    // Group rows are listed by chat UUID, direct chats by the other user
+    const userOnList = document.getElementById('listedUser' + msg.chatUUID) || document.getElementById('listedUser' + msg.userFrom)
+    if (!userOnList) return;
     let dots = Array.from(userOnList.querySelectorAll('.bouncer'));
 
     if (dots) {
@@ -115,20 +158,30 @@ function handleWebSocketMessage(event) {
 
     if (
         msg.msgType == "listOfChat" ||
-        msg.msgType == "updateClients" ||
+        msg.msgType == "presenceChanged" ||
         msg.msgType == "sendMessage" ||
-        msg.msgType == "showMessages"
+        msg.msgType == "showMessages" ||
+        msg.msgType == "messageBacklog" ||
+        msg.msgType == "readReceipt" ||
+        msg.msgType == "messageEdited" ||
+        msg.msgType == "messageDeleted" ||
+        msg.msgType == "chatUpdated"
     ) {
         chatMessages(msg)
     }
 
-    if (msg.msgType == "post" || msg.msgType == "comment") {
+    if (msg.msgType == "post" || msg.msgType == "comment" || msg.msgType == "postUpdated" || msg.msgType == "postDeleted" ||
+        msg.msgType == "commentUpdated" || msg.msgType == "commentDeleted") {
         forumMessages(msg)
     }
 
     if (msg.msgType == "typing" || msg.msgType == "stopped_typing") {
         typingMessages(msg)
     }
+
+    if (msg.msgType == "ack" || msg.msgType == "error") {
+        handleRequestReply(msg)
+    }
 };
 
 function showNotification(sender) {
@@ -173,13 +226,46 @@ function startUp(data) {
     document.getElementById('forum-container').style.display = 'block';
     document.getElementById('profile-section').style.display = 'none';
     document.getElementById('logged-as').textContent = 'Logged in as ' + data.username;
+    currentUser.username = data.username;
+    currentUser.isAdmin = data.isAdmin === true;
 
-    fetchPosts(0);
+    showFeedOrThread();
     // make server respond with list of clients
     getUsersListing();
 
     ws = new WebSocket(`ws://localhost:8080/ws?session=${data.token}`);
     ws.onmessage = event => handleWebSocketMessage(event);
+    startHeartbeat();
+}
+
+// The server marks users idle when their heartbeats report no activity for a while
+const heartbeatInterval = 30000;
+let heartbeatTimer = null;
+let userActive = true;
+
+function sendHeartbeat() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: "heartbeat", active: userActive && !document.hidden }));
+    userActive = false;
+}
+
+function noteActivity() {
+    if (userActive) return;
+    // Tell the server right away when an idle user comes back
+    userActive = true;
+    sendHeartbeat();
+    userActive = true;
+}
+
+function startHeartbeat() {
+    userActive = true;
+    clearInterval(heartbeatTimer);
+    heartbeatTimer = setInterval(sendHeartbeat, heartbeatInterval);
+}
+
+function stopHeartbeat() {
+    clearInterval(heartbeatTimer);
+    heartbeatTimer = null;
 }
 
 function login() {
@@ -236,16 +322,26 @@ function registerUser() {
                 openLogin();
                 document.getElementById('errorMessageLogin').textContent = "User registered succesfully!";
             } else {
-                document.getElementById('errorMessageRegister').textContent = "Registration failed!";
+                document.getElementById('errorMessageRegister').textContent = errorText(data, "Registration failed!");
             }
         });
 }
 
+const errorCodes = { required: 'is required', too_short: 'is too short', too_long: 'is too long', invalid: 'is invalid', out_of_range: 'is out of range' };
+
+// Readable text of a failed request, listing the rejected fields
+export function errorText(data, fallback) {
+    if (!data.errors) return data.message || fallback;
+    return data.errors.map(e => `${e.field} ${errorCodes[e.error] || e.error}`).join(', ');
+}
+
 export function logout() {
     feed.innerHTML = "";
     // Устанавливаем пустой cookie с прошедшей датой, чтобы браузер его удалил
     document.cookie = "session_token=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;";
     
+    stopHeartbeat();
+    currentUser.username = '';
     fetch('/api/logout', { method: 'POST' })
         .then(() => {
             document.getElementById('login-section').style.display = 'flex';
@@ -261,13 +357,14 @@ export function toggleInput() {
     if (inputs.style.display == "none") {
         inputsContainer.style.backgroundColor = "var(--bg6)";
         inputs.style.display = "flex";
+        loadDrafts();
     } else {
         inputsContainer.style.backgroundColor = "";
         inputs.style.display = "none";
     }
 }
 
-function showForum() {
+export function showForum() {
     document.getElementById('forum-container').style.display = 'block';
     document.getElementById('chat-section').style.display = 'none';
     const chatContainer = document.querySelector('.chat-container');
@@ -362,7 +459,7 @@ function messageStoppedTyping() {
     if (chatTextInput) chatTextInput.value = '';
 
     if (previousReceiver) {
-        ws.send(JSON.stringify({ type: "stopped_typing", from: thisUser, to: previousReceiver }));
+        ws.send(JSON.stringify({ type: "stopped_typing", chatUUID: currentChatUUID, to: previousReceiver }));
     }
 }
 
@@ -430,6 +527,16 @@ function showUserProfile(user) {
     messageStoppedTyping();
 }
 
+// A #post/<uuid> link opens that thread, otherwise the feed is shown
+function showFeedOrThread() {
+    const match = location.hash.match(/^#post\/([0-9a-f-]+)$/);
+    if (match) {
+        showThread(match[1]);
+    } else {
+        fetchPosts(0);
+    }
+}
+
 addEventListener("DOMContentLoaded", function () {
 
     document.querySelector('#login-button').addEventListener('click', login);
@@ -439,10 +546,25 @@ addEventListener("DOMContentLoaded", function () {
     document.querySelector('#category-selector').addEventListener('change', updateCategory);
     document.querySelector('#remove-category-button').addEventListener('click', removeLastCategory);
     document.querySelector('#send-post-button').addEventListener('click', sendPost);
+    document.querySelector('#save-draft-button').addEventListener('click', saveDraft);
     document.querySelector('#logout-button').addEventListener('click', logout);
     document.querySelector('#create-post-text').addEventListener('click', toggleInput);
     document.querySelector('#page-title').addEventListener('click', showForum);
     document.querySelector('#my-profile-button').addEventListener('click', myProfile);
+    document.querySelector('#post-sort').addEventListener('change', changeSort);
+    document.querySelector('#load-more-posts').addEventListener('click', fetchMorePosts);
+    document.querySelector('#search-button').addEventListener('click', () => searchPosts());
+    document.querySelector('#search-input').addEventListener('keydown', event => {
+        if (event.key === 'Enter') searchPosts();
+    });
+
+    addEventListener('hashchange', () => {
+        if (currentUser.username) showFeedOrThread();
+    });
+
+    for (const event of ['mousemove', 'keydown', 'click', 'scroll', 'visibilitychange']) {
+        document.addEventListener(event, noteActivity, { passive: true });
+    }
 
     fetchCategories();
 
@@ -0,0 +1,75 @@
+package utils
+
+import "strings"
+
+// Operations of a diff line
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffLine is one line of a diff, encoded as {"op":"insert","text":"..."}
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines compares two texts line by line and returns the lines of both in order,
+// the ones only in from as deleted and the ones only in to as inserted
+func DiffLines(from string, to string) []DiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+
+	// Lines the texts start and end with are equal, only the middle needs the comparison table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	// common[i][j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	common := make([][]int32, len(midA)+1)
+	for i := range common {
+		common[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: line})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: midA[i]})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: midA[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: midB[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	return lines
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// requestInfo is what is known about the request being handled, it's added to every log line of it
+type requestInfo struct {
+	mu       sync.Mutex
+	id       string
+	userUUID string
+}
+
+type requestInfoKey struct{}
+
+// NewRequestID returns a random ID for a request without one
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID starts the log context of a request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{id: id})
+}
+
+// RequestID returns the ID of the request of ctx, empty outside of requests
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
+// SetRequestUser records the logged in user of the request of ctx once the session is checked
+func SetRequestUser(ctx context.Context, userUUID string) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	info.userUUID = userUUID
+	info.mu.Unlock()
+}
+
+// RequestUser returns the user recorded by SetRequestUser, empty when nobody is logged in
+func RequestUser(ctx context.Context) string {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.userUUID
+}
+
+// ParseLogLevel reads debug, info, warn or error
+func ParseLogLevel(text string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(text))
+	return level, err
+}
+
+// NewLogger writes log lines of level and above to w as text or json. Lines logged with the
+// context of a request get its request_id and user
+func NewLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(requestHandler{handler})
+}
+
+// requestHandler adds the request of the context to the records of the handler it wraps
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if userUUID := RequestUser(ctx); userUUID != "" {
+		record.AddAttrs(slog.String("user", userUUID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
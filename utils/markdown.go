@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Text formats of posts, comments and chat messages
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// maxQuoteDepth bounds nested blockquotes, deeper markers are shown as text
+const maxQuoteDepth = 8
+
+// The sanitizer allowlist, nothing else is ever written
+var (
+	allowedTags = map[string]bool{
+		"p": true, "br": true, "strong": true, "em": true, "code": true, "pre": true,
+		"blockquote": true, "ul": true, "ol": true, "li": true, "a": true,
+	}
+	allowedAttrs = map[string]map[string]bool{
+		"a": {"href": true, "rel": true},
+	}
+	allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+)
+
+var (
+	unorderedItem = regexp.MustCompile(`^\s{0,3}[-*+]\s+`)
+	orderedItem   = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+`)
+)
+
+// FormatFor returns the format of a text by whether the author opted in to Markdown
+func FormatFor(markdown bool) string {
+	if markdown {
+		return FormatMarkdown
+	}
+	return FormatPlain
+}
+
+// RenderText renders a stored text in its format to sanitized HTML.
+// Plain text keeps its line breaks, Markdown supports a subset:
+// fenced code blocks, quotes, lists, emphasis, inline code and links
+func RenderText(source string, format string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+
+	var w htmlWriter
+	if format == FormatMarkdown {
+		w.blocks(strings.Split(source, "\n"), 0)
+	} else {
+		w.plain(source)
+	}
+	return w.String()
+}
+
+// inlineTags are left out of plain text without breaking the words around them
+var inlineTags = map[string]bool{"strong": true, "em": true, "code": true, "a": true}
+
+// PlainText returns a stored text without its markup, for the search index. Markdown is
+// rendered first, so only what readers see is kept and link targets are dropped
+func PlainText(source string, format string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	if format != FormatMarkdown {
+		return source
+	}
+
+	// All text of the rendering is escaped, so every < starts one of its tags
+	rendered := RenderText(source, format)
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(rendered, '<')
+		if start < 0 {
+			b.WriteString(rendered)
+			break
+		}
+		b.WriteString(rendered[:start])
+		end := strings.IndexByte(rendered[start:], '>')
+		name, _, _ := strings.Cut(strings.TrimPrefix(rendered[start+1:start+end], "/"), " ")
+		if !inlineTags[name] {
+			b.WriteString("\n")
+		}
+		rendered = rendered[start+end+1:]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(html.UnescapeString(b.String()), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// htmlWriter only emits allowlisted tags and attributes, all text is escaped
+type htmlWriter struct {
+	strings.Builder
+}
+
+func (w *htmlWriter) open(tag string, attrs ...string) {
+	if !allowedTags[tag] {
+		return
+	}
+	w.WriteString("<" + tag)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if allowedAttrs[tag][attrs[i]] {
+			w.WriteString(" " + attrs[i] + `="` + html.EscapeString(attrs[i+1]) + `"`)
+		}
+	}
+	w.WriteString(">")
+}
+
+func (w *htmlWriter) close(tag string) {
+	if allowedTags[tag] && tag != "br" {
+		w.WriteString("</" + tag + ">")
+	}
+}
+
+func (w *htmlWriter) text(s string) {
+	w.WriteString(html.EscapeString(s))
+}
+
+func (w *htmlWriter) plain(source string) {
+	for _, paragraph := range strings.Split(strings.TrimSpace(source), "\n\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		w.open("p")
+		for i, line := range strings.Split(paragraph, "\n") {
+			if i > 0 {
+				w.open("br")
+			}
+			w.text(line)
+		}
+		w.close("p")
+	}
+}
+
+// blocks renders block level Markdown
+func (w *htmlWriter) blocks(lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			i++
+			start := i
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+				i++
+			}
+			w.open("pre")
+			w.open("code")
+			w.text(strings.Join(lines[start:i], "\n"))
+			w.close("code")
+			w.close("pre")
+			i++ // closing fence, an unclosed block runs to the end
+
+		case strings.HasPrefix(trimmed, ">") && depth < maxQuoteDepth:
+			var quoted []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+				i++
+			}
+			w.open("blockquote")
+			w.blocks(quoted, depth+1)
+			w.close("blockquote")
+
+		case unorderedItem.MatchString(line):
+			i = w.list(lines, i, "ul", unorderedItem)
+
+		case orderedItem.MatchString(line):
+			i = w.list(lines, i, "ol", orderedItem)
+
+		default:
+			w.open("p")
+			for first := true; i < len(lines) && !startsBlock(lines[i], depth); i++ {
+				if !first {
+					w.open("br")
+				}
+				w.inline(strings.TrimSpace(lines[i]))
+				first = false
+			}
+			w.close("p")
+		}
+	}
+}
+
+func (w *htmlWriter) list(lines []string, i int, tag string, item *regexp.Regexp) int {
+	w.open(tag)
+	for i < len(lines) && item.MatchString(lines[i]) {
+		w.open("li")
+		w.inline(strings.TrimSpace(item.ReplaceAllString(lines[i], "")))
+		w.close("li")
+		i++
+	}
+	w.close(tag)
+	return i
+}
+
+// startsBlock reports whether a line ends a paragraph
+func startsBlock(line string, depth int) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" ||
+		strings.HasPrefix(trimmed, "```") ||
+		(strings.HasPrefix(trimmed, ">") && depth < maxQuoteDepth) ||
+		unorderedItem.MatchString(line) ||
+		orderedItem.MatchString(line)
+}
+
+// inline renders emphasis, code spans, links and bare URLs
+func (w *htmlWriter) inline(s string) {
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_[]()>#+-.!", rune(rest[1])):
+			w.text(rest[1:2])
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				w.open("code")
+				w.text(rest[1 : end+1])
+				w.close("code")
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				w.open("strong")
+				w.inline(rest[2 : end+2])
+				w.close("strong")
+				i += end + 4
+				continue
+			}
+
+		case (rest[0] == '*' || rest[0] == '_') && len(rest) > 1 && !unicode.IsSpace(rune(rest[1])) &&
+			(rest[0] == '*' || i == 0 || !isWordByte(s[i-1])):
+			if end := strings.IndexByte(rest[1:], rest[0]); end > 0 && !unicode.IsSpace(rune(rest[end])) {
+				w.open("em")
+				w.inline(rest[1 : end+1])
+				w.close("em")
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, href, n, ok := parseLink(rest); ok {
+				w.open("a", "href", href, "rel", "nofollow noopener noreferrer")
+				w.inline(label)
+				w.close("a")
+				i += n
+				continue
+			}
+
+		case (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")) && (i == 0 || !isWordByte(s[i-1])):
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			link := strings.TrimRight(rest[:end], ".,;:!?)'\"")
+			if href, ok := safeURL(link); ok {
+				w.open("a", "href", href, "rel", "nofollow noopener noreferrer")
+				w.text(link)
+				w.close("a")
+				i += len(link)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		w.text(rest[:size])
+		i += size
+	}
+}
+
+// parseLink parses [label](url) at the start of s
+func parseLink(s string) (label string, href string, n int, ok bool) {
+	closeLabel := strings.Index(s, "](")
+	if closeLabel < 1 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeLabel+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+	href, ok = safeURL(strings.TrimSpace(s[closeLabel+2 : closeLabel+2+closeURL]))
+	if !ok {
+		return "", "", 0, false
+	}
+	return s[1:closeLabel], href, closeLabel + 3 + closeURL, true
+}
+
+// safeURL accepts absolute links with an allowlisted scheme only, so no javascript: or data: URLs
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	if u.Scheme != "mailto" && u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"log"
 	"strings"
 
 	"github.com/gofrs/uuid/v5"
@@ -11,7 +10,6 @@ func GenerateUuid() (string, error) {
 	// Create a Version 4 UUID.
 	u2, err := uuid.NewV4()
 	if err != nil {
-		log.Fatalf("failed to generate UUID: %v", err)
 		return "", err
 	}
 
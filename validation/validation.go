@@ -0,0 +1,273 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Error codes of rejected fields
+const (
+	Required   = "required"
+	TooShort   = "too_short"
+	TooLong    = "too_long"
+	Invalid    = "invalid"
+	OutOfRange = "out_of_range"
+)
+
+// Limits of user input, lengths count characters
+type Limits struct {
+	UsernameMinLen     int
+	UsernameMaxLen     int
+	NameMaxLen         int // first and last name
+	EmailMaxLen        int
+	PasswordMinLen     int
+	PasswordMaxLen     int // bcrypt ignores anything after 72 bytes
+	MinAge             int
+	MaxAge             int
+	TitleMaxLen        int
+	ContentMaxLen      int // posts and comments
+	MessageMaxLen      int
+	CategoryNameMaxLen int
+	GroupNameMaxLen    int
+}
+
+// DefaultLimits are used until SetLimits is called
+var DefaultLimits = Limits{
+	UsernameMinLen:     3,
+	UsernameMaxLen:     20,
+	NameMaxLen:         50,
+	EmailMaxLen:        254,
+	PasswordMinLen:     6,
+	PasswordMaxLen:     72,
+	MinAge:             13,
+	MaxAge:             150,
+	TitleMaxLen:        100,
+	ContentMaxLen:      3000,
+	MessageMaxLen:      1000,
+	CategoryNameMaxLen: 30,
+	GroupNameMaxLen:    50,
+}
+
+var limits = DefaultLimits
+
+var (
+	genders         = []string{"female", "male", "other", "unspecified"}
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`) // no @, logins tell usernames and e-mails apart by it
+)
+
+// SetLimits replaces the limits, call it at startup before serving requests
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// CurrentLimits returns the limits in use
+func CurrentLimits() Limits {
+	return limits
+}
+
+// FieldError is one rejected field, encoded as {"field":"title","error":"too_long"}
+type FieldError struct {
+	Field string `json:"field"`
+	Code  string `json:"error"`
+}
+
+// Errors are all rejected fields of a request
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	parts := make([]string, len(errs))
+	for i, err := range errs {
+		parts[i] = err.Field + " " + err.Code
+	}
+	return "invalid input: " + strings.Join(parts, ", ")
+}
+
+// WriteErrors answers 400 with the field errors when err is Errors, and reports whether it did
+func WriteErrors(w http.ResponseWriter, err error) bool {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"message": "Invalid input",
+		"errors":  errs,
+	})
+	return true
+}
+
+// Validator collects the field errors of one request
+type Validator struct {
+	errs Errors
+}
+
+// Add rejects a field, only the first error of a field is kept
+func (v *Validator) Add(field string, code string) {
+	for _, err := range v.errs {
+		if err.Field == field {
+			return
+		}
+	}
+	v.errs = append(v.errs, FieldError{Field: field, Code: code})
+}
+
+// Length checks the trimmed length of a required text
+func (v *Validator) Length(field string, value string, min int, max int) {
+	length := utf8.RuneCountInString(strings.TrimSpace(value))
+	switch {
+	case length == 0:
+		v.Add(field, Required)
+	case length < min:
+		v.Add(field, TooShort)
+	case max > 0 && length > max:
+		v.Add(field, TooLong)
+	}
+}
+
+// Range checks an integer given as text
+func (v *Validator) Range(field string, value string, min int, max int) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		v.Add(field, Required)
+		return
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		v.Add(field, Invalid)
+		return
+	}
+	if number < min || number > max {
+		v.Add(field, OutOfRange)
+	}
+}
+
+// OneOf checks a value against the allowed ones
+func (v *Validator) OneOf(field string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	if value == "" {
+		v.Add(field, Required)
+	} else {
+		v.Add(field, Invalid)
+	}
+}
+
+// Check rejects a field with code unless ok
+func (v *Validator) Check(ok bool, field string, code string) {
+	if !ok {
+		v.Add(field, code)
+	}
+}
+
+// Err returns the collected Errors, or nil when the input is valid
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Registration validates the fields of a new user
+func Registration(username, age, gender, firstName, lastName, email, password string) error {
+	var v Validator
+	v.Length("username", username, limits.UsernameMinLen, limits.UsernameMaxLen)
+	v.Check(username == "" || usernamePattern.MatchString(strings.TrimSpace(username)), "username", Invalid)
+	v.Range("age", age, limits.MinAge, limits.MaxAge)
+	v.OneOf("gender", gender, genders...)
+	v.Length("firstName", firstName, 1, limits.NameMaxLen)
+	v.Length("lastName", lastName, 1, limits.NameMaxLen)
+	v.Length("email", email, 1, limits.EmailMaxLen)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != strings.TrimSpace(email) {
+		v.Add("email", Invalid) // a bare address, no display name
+	}
+	// Passwords aren't trimmed, and bcrypt limits their bytes
+	switch {
+	case password == "":
+		v.Add("password", Required)
+	case utf8.RuneCountInString(password) < limits.PasswordMinLen:
+		v.Add("password", TooShort)
+	case len(password) > limits.PasswordMaxLen:
+		v.Add("password", TooLong)
+	}
+	return v.Err()
+}
+
+// Post validates a new or edited post, categories are the IDs of the categories posts may use
+func Post(title string, content string, categoryIDs []int, categories map[int]bool) error {
+	var v Validator
+	v.post(title, content, categoryIDs, categories)
+	return v.Err()
+}
+
+func (v *Validator) post(title string, content string, categoryIDs []int, categories map[int]bool) {
+	v.Length("title", title, 1, limits.TitleMaxLen)
+	v.Length("content", content, 1, limits.ContentMaxLen)
+	v.Check(len(categoryIDs) > 0, "categoryIds", Required)
+	v.categories(categoryIDs, categories)
+}
+
+// categories rejects the IDs that aren't in categories
+func (v *Validator) categories(categoryIDs []int, categories map[int]bool) {
+	for _, id := range categoryIDs {
+		v.Check(categories[id], "categoryIds", Invalid)
+	}
+}
+
+// Draft validates a saved draft, which may still lack fields but not all of them
+func Draft(title string, content string, categoryIDs []int, categories map[int]bool) error {
+	var v Validator
+	title, content = strings.TrimSpace(title), strings.TrimSpace(content)
+	v.Check(title != "" || content != "", "content", Required)
+	v.Check(utf8.RuneCountInString(title) <= limits.TitleMaxLen, "title", TooLong)
+	v.Check(utf8.RuneCountInString(content) <= limits.ContentMaxLen, "content", TooLong)
+	v.categories(categoryIDs, categories)
+	return v.Err()
+}
+
+// ScheduledPost validates a draft to be published at publishAt, it has to be complete by then
+func ScheduledPost(title string, content string, categoryIDs []int, categories map[int]bool, publishAt time.Time) error {
+	var v Validator
+	v.post(title, content, categoryIDs, categories)
+	v.Check(publishAt.After(time.Now()), "publishAt", OutOfRange)
+	return v.Err()
+}
+
+// Comment validates a new or edited comment
+func Comment(content string) error {
+	var v Validator
+	v.Length("content", content, 1, limits.ContentMaxLen)
+	return v.Err()
+}
+
+// Message validates a new or edited chat message
+func Message(content string) error {
+	var v Validator
+	v.Length("content", content, 1, limits.MessageMaxLen)
+	return v.Err()
+}
+
+// CategoryName validates the name of a category
+func CategoryName(name string) error {
+	var v Validator
+	v.Length("name", name, 1, limits.CategoryNameMaxLen)
+	return v.Err()
+}
+
+// GroupName validates the name of a group chat
+func GroupName(name string) error {
+	var v Validator
+	v.Length("name", name, 1, limits.GroupNameMaxLen)
+	return v.Err()
+}